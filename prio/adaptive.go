@@ -0,0 +1,146 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "sort"
+
+// DefaultAdaptiveThreshold is the threshold used by a zero AdaptiveQueue.
+const DefaultAdaptiveThreshold = 32
+
+// AdaptiveQueue represents a priority queue that keeps few elements
+// in a sorted slice, which has lower constant factors than a heap,
+// and switches to a heap when it grows beyond a threshold.
+// It switches back when it shrinks below half the threshold.
+// The zero value for AdaptiveQueue is an empty queue ready to use,
+// with threshold DefaultAdaptiveThreshold.
+type AdaptiveQueue struct {
+	q         Queue // in sorted mode, q.h is sorted in descending order
+	heap      bool
+	threshold int
+}
+
+// NewAdaptiveQueue returns an empty queue that uses a heap when it holds
+// more than threshold elements.
+func NewAdaptiveQueue(threshold int) AdaptiveQueue {
+	return AdaptiveQueue{threshold: threshold}
+}
+
+// Push pushes the element x onto the queue.
+// The complexity is O(n) in sorted mode and O(log(n)) in heap mode, where n = q.Len().
+func (a *AdaptiveQueue) Push(x Interface) {
+	if a.heap {
+		a.q.Push(x)
+		return
+	}
+	h := a.q.h
+	i := sort.Search(len(h), func(i int) bool { return h[i].Less(x) })
+	h = append(h, nil)
+	copy(h[i+1:], h[i:])
+	h[i] = x
+	a.q.h = h
+	for ; i < len(h); i++ {
+		h[i].Index(i)
+	}
+	if len(h) > a.limit() {
+		a.toHeap()
+	}
+}
+
+// Pop removes a minimum element (according to Less) from the queue and returns it.
+// The complexity is O(1) in sorted mode and O(log(n)) in heap mode, where n = q.Len().
+func (a *AdaptiveQueue) Pop() Interface {
+	if a.heap {
+		x := a.q.Pop()
+		a.shrink()
+		return x
+	}
+	return a.Remove(len(a.q.h) - 1)
+}
+
+// Peek returns, but does not remove, a minimum element (according to Less) of the queue.
+func (a *AdaptiveQueue) Peek() Interface {
+	if a.heap {
+		return a.q.h[0]
+	}
+	return a.q.h[len(a.q.h)-1]
+}
+
+// Remove removes the element at index i from the queue and returns it.
+// The complexity is O(n) in sorted mode and O(log(n)) in heap mode, where n = q.Len().
+func (a *AdaptiveQueue) Remove(i int) Interface {
+	if a.heap {
+		x := a.q.Remove(i)
+		a.shrink()
+		return x
+	}
+	h := a.q.h
+	x := h[i]
+	copy(h[i:], h[i+1:])
+	h[len(h)-1] = nil
+	h = h[:len(h)-1]
+	a.q.h = h
+	for ; i < len(h); i++ {
+		h[i].Index(i)
+	}
+	x.Index(-1) // for safety
+	return x
+}
+
+// Fix reestablishes the ordering after the element at index i has changed its value.
+// The complexity is O(n) in sorted mode and O(log(n)) in heap mode, where n = q.Len().
+func (a *AdaptiveQueue) Fix(i int) {
+	if a.heap {
+		a.q.Fix(i)
+		return
+	}
+	a.Push(a.Remove(i))
+}
+
+// Len returns the number of elements in the queue.
+func (a *AdaptiveQueue) Len() int {
+	return len(a.q.h)
+}
+
+func (a *AdaptiveQueue) limit() int {
+	if a.threshold == 0 {
+		return DefaultAdaptiveThreshold
+	}
+	return a.threshold
+}
+
+// Switches to heap mode. An ascending sorted slice is already a heap.
+func (a *AdaptiveQueue) toHeap() {
+	h := a.q.h
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	for i, x := range h {
+		x.Index(i)
+	}
+	a.heap = true
+}
+
+// Switches to sorted mode if the queue has become small enough.
+func (a *AdaptiveQueue) shrink() {
+	h := a.q.h
+	if len(h) >= a.limit()/2 {
+		return
+	}
+	sort.Slice(h, func(i, j int) bool { return h[j].Less(h[i]) })
+	for i, x := range h {
+		x.Index(i)
+	}
+	a.heap = false
+}
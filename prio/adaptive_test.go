@@ -0,0 +1,87 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "testing"
+
+// Checks that every element of a knows its index.
+func verifyAdaptive(t *testing.T, a *AdaptiveQueue) {
+	if a.heap {
+		verify(t, a.q)
+		return
+	}
+	for i, x := range a.q.h {
+		if i > 0 && a.q.h[i-1].Less(x) {
+			t.Errorf("sorted order invalidated at [%d]", i)
+		}
+		if index := x.(*myType).index; index != i {
+			t.Errorf("wrong index [%d] = %d", i, index)
+		}
+	}
+}
+
+func TestAdaptiveQueue(t *testing.T) {
+	a := NewAdaptiveQueue(8)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 20; i++ {
+			a.Push(&myType{i * 7 % 20, -1})
+			verifyAdaptive(t, &a)
+			if heap := a.Len() > 8; round == 0 && a.heap != heap {
+				t.Errorf("Len() = %d: heap mode = %v; want %v", a.Len(), a.heap, heap)
+			}
+		}
+		x := a.q.h[5].(*myType)
+		x.value = -1
+		a.Fix(x.index)
+		verifyAdaptive(t, &a)
+		if a.Peek() != x {
+			t.Errorf("Peek() = %v after Fix; want %v", a.Peek(), x)
+		}
+
+		for prev := -2; a.Len() > 0; {
+			x := a.Pop().(*myType)
+			verifyAdaptive(t, &a)
+			if x.value < prev {
+				t.Errorf("Pop() got %d after %d; want ascending", x.value, prev)
+			}
+			if x.index != -1 {
+				t.Errorf("index of popped element = %d; want -1", x.index)
+			}
+			prev = x.value
+		}
+		if a.heap {
+			t.Errorf("empty queue is in heap mode")
+		}
+	}
+}
+
+func benchmarkSmall(b *testing.B, push func(Interface), pop func() Interface) {
+	for i := 0; i < 8; i++ {
+		push(myInt(i * 5 % 8))
+	}
+	for i := 0; i < b.N; i++ {
+		push(pop().(myInt) + 8)
+	}
+}
+
+func BenchmarkSmallHeap(b *testing.B) {
+	var q Queue
+	benchmarkSmall(b, q.Push, q.Pop)
+}
+
+func BenchmarkSmallAdaptive(b *testing.B) {
+	var a AdaptiveQueue
+	benchmarkSmall(b, a.Push, a.Pop)
+}
@@ -38,3 +38,53 @@ func BuildTestQueue(n int) Queue {
 	}
 	return New(a...)
 }
+
+// Elements that count their comparisons; cmpInt also implements Comparable.
+type lessInt struct {
+	v int
+	n *int
+}
+
+type cmpInt struct{ lessInt }
+
+func (x lessInt) Less(y Interface) bool {
+	*x.n++
+	return x.v < value(y)
+}
+func (x lessInt) Index(i int) {}
+
+func (x cmpInt) Compare(y Interface) int {
+	*x.n++
+	return x.v - value(y)
+}
+
+func value(x Interface) int {
+	if c, ok := x.(cmpInt); ok {
+		return c.v
+	}
+	return x.(lessInt).v
+}
+
+func benchmarkStable(b *testing.B, comparable bool) {
+	b.StopTimer()
+	var count int
+	q := NewWithOptions(Options{Stable: true})
+	for i := 0; i < b.N; i++ {
+		e := cmpInt{lessInt{i % 64, &count}}
+		if comparable {
+			q.Push(e)
+		} else {
+			q.Push(e.lessInt)
+		}
+	}
+	count = 0
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		q.Pop()
+	}
+	b.ReportMetric(float64(count)/float64(b.N), "cmps/op")
+}
+
+func BenchmarkPopStableLess(b *testing.B)    { benchmarkStable(b, false) }
+func BenchmarkPopStableCompare(b *testing.B) { benchmarkStable(b, true) }
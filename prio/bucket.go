@@ -0,0 +1,86 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+// BucketQueue represents a priority queue for a small, fixed number of
+// integer priority levels, where a lower level has higher priority.
+// Instead of comparing elements, it keeps a FIFO queue per level, so
+// elements of the same level are popped in the order they were pushed,
+// and Push and Pop take O(1) amortized time.
+type BucketQueue struct {
+	levels []bucket
+	low    int // no level below low holds an element
+	n      int
+}
+
+type bucket struct {
+	xs   []any
+	head int // index in xs of the oldest element
+}
+
+// NewBucketQueue returns an empty queue with the levels 0 to levels-1.
+// It panics if levels is not positive.
+func NewBucketQueue(levels int) BucketQueue {
+	if levels <= 0 {
+		panic("prio: invalid number of levels")
+	}
+	return BucketQueue{levels: make([]bucket, levels)}
+}
+
+// Push adds x at the given level, which must be in [0, q.Levels()).
+// The complexity is O(1) amortized.
+func (q *BucketQueue) Push(level int, x any) {
+	b := &q.levels[level]
+	b.xs = append(b.xs, x)
+	q.low = min(q.low, level)
+	q.n++
+}
+
+// Pop removes the oldest element of the lowest non-empty level and returns
+// it, and true; for an empty queue it returns (nil, false).
+// The complexity is O(1) amortized, as the search for the lowest
+// non-empty level never moves past a level that Push has not refilled.
+func (q *BucketQueue) Pop() (any, bool) {
+	if q.n == 0 {
+		return nil, false
+	}
+	for len(q.levels[q.low].xs) == 0 {
+		q.low++
+	}
+	b := &q.levels[q.low]
+	x := b.xs[b.head]
+	b.xs[b.head] = nil
+	b.head++
+	if b.head > len(b.xs)/2 {
+		// Move the rest to the front, so that a level that never
+		// empties does not grow without bound; the copying is paid
+		// for by the pops since the previous move.
+		n := copy(b.xs, b.xs[b.head:])
+		clear(b.xs[n:])
+		b.xs, b.head = b.xs[:n], 0
+	}
+	q.n--
+	return x, true
+}
+
+// Len returns the number of elements in the queue.
+func (q *BucketQueue) Len() int {
+	return q.n
+}
+
+// Levels returns the number of priority levels of the queue.
+func (q *BucketQueue) Levels() int {
+	return len(q.levels)
+}
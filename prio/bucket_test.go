@@ -0,0 +1,66 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBucketQueue(t *testing.T) {
+	q := NewBucketQueue(4)
+	if x, ok := q.Pop(); ok {
+		t.Errorf("Pop() on empty queue = %v, true; want nil, false", x)
+	}
+	for i, level := range []int{2, 0, 3, 2, 0, 1, 3, 2} {
+		q.Push(level, fmt.Sprintf("%d.%d", level, i))
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		x, _ := q.Pop()
+		got = append(got, x.(string))
+	}
+	q.Push(0, "0.8") // lower than the level being drained
+	q.Push(3, "3.9")
+	for q.Len() > 0 {
+		x, ok := q.Pop()
+		if !ok {
+			t.Fatalf("Pop() = _, false with Len() = %d", q.Len())
+		}
+		got = append(got, x.(string))
+	}
+	want := "0.1 0.4 1.5 0.8 2.0 2.3 2.7 3.2 3.6 3.9"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("pops = %s; want %s", s, want)
+	}
+	if q.Levels() != 4 {
+		t.Errorf("Levels() = %d; want 4", q.Levels())
+	}
+}
+
+func TestBucketQueueBounded(t *testing.T) {
+	q := NewBucketQueue(2)
+	q.Push(1, -1)
+	for i := 0; i < 100000; i++ {
+		q.Push(1, i)
+		if x, _ := q.Pop(); x != i-1 {
+			t.Fatalf("Pop() = %v; want %d", x, i-1)
+		}
+	}
+	if n := len(q.levels[1].xs); q.Len() != 1 || n > 4 {
+		t.Errorf("Len() = %d with %d slots in use; want 1 with a few", q.Len(), n)
+	}
+}
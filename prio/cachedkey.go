@@ -0,0 +1,178 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import (
+	"math"
+	"time"
+)
+
+// CachedKeyQueue represents a priority queue ordered by an integer key
+// that is computed once per element, when the element is pushed,
+// instead of calling Less for every comparison. This pays off when
+// the priority of an element is expensive to compute.
+// The Less method of the elements is not used; Index is called as for Queue.
+type CachedKeyQueue struct {
+	h   []keyed
+	key func(x Interface) int64
+}
+
+type keyed struct {
+	key int64
+	x   Interface
+}
+
+// NewCachedKey returns an empty queue that orders elements by ascending key(x).
+func NewCachedKey(key func(x Interface) int64) CachedKeyQueue {
+	return CachedKeyQueue{key: key}
+}
+
+// NewFloatSafe returns an empty queue that orders elements by ascending
+// float key(x). Unlike a Less method that compares floats with <, which is
+// false for every comparison with NaN and therefore corrupts the heap, it
+// uses a total order: NaN keys sort after all other keys, +Inf included,
+// and -0 equals +0. The keys reported by PeekKey are not the float keys,
+// but integers with the same order.
+func NewFloatSafe(key func(x Interface) float64) CachedKeyQueue {
+	return NewCachedKey(func(x Interface) int64 { return floatOrder(key(x)) })
+}
+
+// Push pushes the element x onto the queue.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *CachedKeyQueue) Push(x Interface) {
+	n := len(q.h)
+	q.h = append(q.h, keyed{q.key(x), x})
+	q.up(n)
+}
+
+// Pop removes an element with minimum key from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *CachedKeyQueue) Pop() Interface {
+	return q.Remove(0)
+}
+
+// Peek returns, but does not remove, an element with minimum key.
+func (q *CachedKeyQueue) Peek() Interface {
+	return q.h[0].x
+}
+
+// PeekKey returns the cached key of the element returned by Peek.
+func (q *CachedKeyQueue) PeekKey() int64 {
+	return q.h[0].key
+}
+
+// Remove removes the element at index i from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *CachedKeyQueue) Remove(i int) Interface {
+	h := q.h
+	n := len(h) - 1
+	x := h[i].x
+	h[i], h[n] = h[n], keyed{}
+	q.h = h[:n]
+	if i < n {
+		q.down(i) // h[i].x.Index(i) is done by down.
+		q.up(i)
+	}
+	x.Index(-1) // for safety
+	return x
+}
+
+// Refresh recomputes the cached key of the element at index i,
+// after its priority has changed, and reestablishes the heap ordering.
+// The complexity is O(log(n)) where n = q.Len().
+func (q *CachedKeyQueue) Refresh(i int) {
+	q.h[i].key = q.key(q.h[i].x)
+	q.up(i)
+	q.down(i)
+}
+
+// AgeAll replaces the cached key of every element by agedKey(x, now)
+// and then reestablishes the heap ordering once, which is cheaper than
+// a Refresh per element. It is meant for aging, where waiting elements
+// gain priority over time. The key function of the queue is not changed,
+// so Push and Refresh still use it.
+// The complexity is O(n), where n = q.Len(), plus the cost of agedKey.
+func (q *CachedKeyQueue) AgeAll(now time.Time, agedKey func(x Interface, now time.Time) int64) {
+	for i := range q.h {
+		q.h[i].key = agedKey(q.h[i].x, now)
+	}
+	for i := len(q.h)/2 - 1; i >= 0; i-- {
+		q.down(i)
+	}
+	for i := len(q.h) / 2; i < len(q.h); i++ {
+		q.h[i].x.Index(i)
+	}
+}
+
+// Len returns the number of elements in the queue.
+func (q *CachedKeyQueue) Len() int {
+	return len(q.h)
+}
+
+// Moves element at position i towards top of heap to restore invariant.
+func (q *CachedKeyQueue) up(i int) {
+	h := q.h
+	for i > 0 {
+		parent := (i - 1) / 2
+		if h[parent].key < h[i].key {
+			break
+		}
+		h[parent], h[i] = h[i], h[parent]
+		h[i].x.Index(i)
+		i = parent
+	}
+	h[i].x.Index(i)
+}
+
+// Moves element at position i towards bottom of heap to restore invariant.
+func (q *CachedKeyQueue) down(i int) {
+	h := q.h
+	n := len(h)
+	for {
+		j := firstChild(i, n, 2)
+		if j < 0 {
+			break
+		}
+		if right := j + 1; right < n && h[right].key < h[j].key {
+			j = right
+		}
+		if h[i].key < h[j].key {
+			break
+		}
+		h[i], h[j] = h[j], h[i]
+		h[i].x.Index(i)
+		i = j
+	}
+	h[i].x.Index(i)
+}
+
+// Maps f to an integer such that the integers of two floats compare like
+// the floats, with all NaNs equal to each other and greater than +Inf.
+func floatOrder(f float64) int64 {
+	if math.IsNaN(f) {
+		return math.MaxInt64
+	}
+	if f == 0 {
+		f = 0 // -0 becomes +0
+	}
+	const sign = 1 << 63
+	u := math.Float64bits(f)
+	if u&sign != 0 {
+		u = ^u // negative: larger magnitude means smaller
+	} else {
+		u |= sign
+	}
+	return int64(u ^ sign)
+}
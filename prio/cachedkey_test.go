@@ -0,0 +1,124 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCachedKeyQueue(t *testing.T) {
+	calls := 0
+	key := func(x Interface) int64 {
+		calls++
+		return int64(x.(*myType).value)
+	}
+	q := NewCachedKey(key)
+	a := make([]*myType, 50)
+	for i := range a {
+		a[i] = &myType{i * 17 % 50, -1}
+		q.Push(a[i])
+	}
+	if calls != len(a) {
+		t.Errorf("key called %d times for %d pushes; want once per push", calls, len(a))
+	}
+	for i, e := range q.h {
+		if e.x.(*myType).index != i {
+			t.Errorf("wrong index [%d] = %d", i, e.x.(*myType).index)
+		}
+		if i > 0 && e.key < q.h[(i-1)/2].key {
+			t.Errorf("heap invariant invalidated at [%d]", i)
+		}
+	}
+
+	a[40].value = -1
+	q.Refresh(a[40].index)
+	if q.Peek() != a[40] || q.PeekKey() != -1 {
+		t.Errorf("Peek() = %v after Refresh; want %v", q.Peek(), a[40])
+	}
+
+	for prev := int64(-2); q.Len() > 0; {
+		k := q.PeekKey()
+		x := q.Pop().(*myType)
+		if k != int64(x.value) || k < prev {
+			t.Errorf("Pop() got %d after %d; want ascending keys", x.value, prev)
+		}
+		prev = k
+	}
+}
+
+func TestFloatSafe(t *testing.T) {
+	nan := math.NaN()
+	keys := []float64{3, nan, -1, math.Inf(1), nan, 0, math.Copysign(0, -1), -2.5, math.Inf(-1), 1e-300, nan, -1e300}
+	q := NewFloatSafe(func(x Interface) float64 { return keys[x.(*myType).value] })
+	a := make([]*myType, len(keys))
+	for i := range keys {
+		a[i] = &myType{i, -1}
+		q.Push(a[i])
+	}
+	var got []float64
+	for q.Len() > 0 {
+		got = append(got, keys[q.Pop().(*myType).value])
+	}
+	want := []float64{math.Inf(-1), -1e300, -2.5, -1, 0, 0, 1e-300, 3, math.Inf(1), nan, nan, nan}
+	for i := range want {
+		if got[i] != want[i] && !(math.IsNaN(got[i]) && math.IsNaN(want[i])) {
+			t.Errorf("pops = %v; want %v", got, want)
+			break
+		}
+	}
+
+	for _, f := range []float64{-1e300, -1, -1e-300, 0, 1e-300, 1, 1e300, math.Inf(1)} {
+		if g := math.Nextafter(f, math.Inf(-1)); floatOrder(g) >= floatOrder(f) {
+			t.Errorf("floatOrder(%g) >= floatOrder(%g)", g, f)
+		}
+	}
+	if floatOrder(math.Copysign(0, -1)) != floatOrder(0) {
+		t.Errorf("floatOrder(-0) != floatOrder(0)")
+	}
+	if floatOrder(math.Inf(1)) >= floatOrder(nan) {
+		t.Errorf("floatOrder(+Inf) >= floatOrder(NaN)")
+	}
+}
+
+func TestAgeAll(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	prio := make(map[*myType]int64)
+	since := make(map[*myType]time.Time)
+	q := NewCachedKey(func(x Interface) int64 { return prio[x.(*myType)] })
+	a := make([]*myType, 10)
+	for i := range a {
+		a[i] = &myType{i, -1}
+		prio[a[i]] = int64(i)
+		since[a[i]] = start.Add(time.Duration(9-i) * time.Second) // the least urgent jobs waited longest
+		q.Push(a[i])
+	}
+	// Every second of waiting is worth 2 priority units.
+	aged := func(x Interface, now time.Time) int64 {
+		return prio[x.(*myType)] - 2*int64(now.Sub(since[x.(*myType)])/time.Second)
+	}
+	q.AgeAll(start.Add(20*time.Second), aged)
+	for i, e := range q.h {
+		if e.x.(*myType).index != i {
+			t.Errorf("wrong index [%d] = %d", i, e.x.(*myType).index)
+		}
+	}
+	for want := 9; q.Len() > 0; want-- {
+		if k, x := q.PeekKey(), q.Pop().(*myType); x.value != want || k != int64(-want-22) {
+			t.Errorf("Pop() = %d with key %d; want %d with key %d", x.value, k, want, -want-22)
+		}
+	}
+}
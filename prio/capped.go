@@ -0,0 +1,78 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+// CappedQueue represents a priority queue that holds at most a fixed number
+// of elements. When the queue is full, Push rejects new elements
+// rather than evicting queued ones, which suits load shedding.
+type CappedQueue struct {
+	q   Queue
+	max int
+}
+
+// NewCapped returns an empty queue that holds at most capacity elements.
+func NewCapped(capacity int) CappedQueue {
+	return CappedQueue{max: capacity}
+}
+
+// Push pushes the element x onto the queue and returns true,
+// or returns false without changing the queue if it is full.
+// The complexity is O(log(n)), where n = q.Len().
+func (c *CappedQueue) Push(x Interface) bool {
+	if !c.CanPush() {
+		return false
+	}
+	c.q.Push(x)
+	return true
+}
+
+// CanPush reports whether the queue has room for another element,
+// that is, whether a Push right now would succeed.
+func (c *CappedQueue) CanPush() bool {
+	return len(c.q.h) < c.max
+}
+
+// Pop removes a minimum element (according to Less) from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len().
+func (c *CappedQueue) Pop() Interface {
+	return c.q.Pop()
+}
+
+// Peek returns, but does not remove, a minimum element (according to Less) of the queue.
+func (c *CappedQueue) Peek() Interface {
+	return c.q.Peek()
+}
+
+// Remove removes the element at index i from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len().
+func (c *CappedQueue) Remove(i int) Interface {
+	return c.q.Remove(i)
+}
+
+// Fix reestablishes the heap ordering after the element at index i has changed its value.
+// The complexity is O(log(n)) where n = q.Len().
+func (c *CappedQueue) Fix(i int) {
+	c.q.Fix(i)
+}
+
+// Len returns the number of elements in the queue.
+func (c *CappedQueue) Len() int {
+	return len(c.q.h)
+}
+
+// Cap returns the maximum number of elements the queue can hold.
+func (c *CappedQueue) Cap() int {
+	return c.max
+}
@@ -0,0 +1,54 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "testing"
+
+func TestCappedQueue(t *testing.T) {
+	c := NewCapped(5)
+	for i := 5; i > 0; i-- {
+		if !c.CanPush() {
+			t.Errorf("CanPush() with %d elements = false; want true", c.Len())
+		}
+		if !c.Push(myInt(i)) {
+			t.Errorf("Push(%d) = false; want true", i)
+		}
+	}
+	if c.CanPush() {
+		t.Errorf("CanPush() on full queue = true; want false")
+	}
+	if c.Push(myInt(0)) {
+		t.Errorf("Push on full queue = true; want false")
+	}
+	if c.Len() != 5 || c.Cap() != 5 {
+		t.Errorf("Len(), Cap() = %d, %d; want 5, 5", c.Len(), c.Cap())
+	}
+	if x := c.Peek(); x != myInt(1) {
+		t.Errorf("Peek() = %v; want 1 (rejected push must not change the queue)", x)
+	}
+	if x := c.Pop(); x != myInt(1) {
+		t.Errorf("Pop() = %v; want 1", x)
+	}
+	if !c.CanPush() {
+		t.Errorf("CanPush() after Pop = false; want true")
+	}
+	if !c.Push(myInt(0)) {
+		t.Errorf("Push after Pop = false; want true")
+	}
+	if x := c.Peek(); x != myInt(0) {
+		t.Errorf("Peek() = %v; want 0", x)
+	}
+	verify(t, c.q)
+}
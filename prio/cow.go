@@ -0,0 +1,97 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+// COWQueue represents a priority queue with cheap snapshots.
+// A snapshot shares the heap with the queue until the queue is next changed;
+// only then does the queue copy its heap (copy-on-write).
+// The zero value for COWQueue is an empty queue ready to use.
+type COWQueue struct {
+	q      Queue
+	shared bool // q.h is shared with a snapshot
+}
+
+// Snapshot is a read-only view of a COWQueue at the time Snapshot was called.
+type Snapshot struct {
+	h []Interface
+}
+
+// Snapshot returns a view of the current contents of the queue.
+// The complexity is O(1); the next change to the queue costs an extra O(n) copy.
+func (q *COWQueue) Snapshot() Snapshot {
+	q.shared = true
+	return Snapshot{q.q.h}
+}
+
+// Push pushes the element x onto the queue.
+// The complexity is O(log(n)), where n = q.Len(), plus a copy after a snapshot.
+func (q *COWQueue) Push(x Interface) {
+	q.own()
+	q.q.Push(x)
+}
+
+// Pop removes a minimum element (according to Less) from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len(), plus a copy after a snapshot.
+func (q *COWQueue) Pop() Interface {
+	q.own()
+	return q.q.Pop()
+}
+
+// Remove removes the element at index i from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len(), plus a copy after a snapshot.
+func (q *COWQueue) Remove(i int) Interface {
+	q.own()
+	return q.q.Remove(i)
+}
+
+// Fix reestablishes the heap ordering after the element at index i has changed its value.
+// The complexity is O(log(n)), where n = q.Len(), plus a copy after a snapshot.
+func (q *COWQueue) Fix(i int) {
+	q.own()
+	q.q.Fix(i)
+}
+
+// Peek returns, but does not remove, a minimum element (according to Less) of the queue.
+func (q *COWQueue) Peek() Interface {
+	return q.q.Peek()
+}
+
+// Len returns the number of elements in the queue.
+func (q *COWQueue) Len() int {
+	return q.q.Len()
+}
+
+// Makes sure that the heap is not shared with a snapshot.
+func (q *COWQueue) own() {
+	if q.shared {
+		q.q.h = append(make([]Interface, 0, cap(q.q.h)), q.q.h...)
+		q.shared = false
+	}
+}
+
+// Len returns the number of elements in the snapshot.
+func (s Snapshot) Len() int {
+	return len(s.h)
+}
+
+// Peek returns a minimum element (according to Less) of the snapshot.
+func (s Snapshot) Peek() Interface {
+	return s.h[0]
+}
+
+// Elements returns a copy of the elements of the snapshot in heap order.
+func (s Snapshot) Elements() []Interface {
+	return append([]Interface(nil), s.h...)
+}
@@ -0,0 +1,50 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "testing"
+
+func TestCOWQueue(t *testing.T) {
+	var q COWQueue
+	for i := 10; i > 0; i-- {
+		q.Push(myInt(i))
+	}
+	s := q.Snapshot()
+	before := s.Elements()
+
+	q.Pop()
+	q.Push(myInt(0))
+	q.Push(myInt(20))
+	q.Remove(3)
+	if q.Peek() != myInt(0) {
+		t.Errorf("Peek() = %v; want 0", q.Peek())
+	}
+
+	if s.Len() != 10 {
+		t.Errorf("snapshot Len() = %d; want 10", s.Len())
+	}
+	if s.Peek() != myInt(1) {
+		t.Errorf("snapshot Peek() = %v; want 1", s.Peek())
+	}
+	for i, x := range s.Elements() {
+		if x != before[i] {
+			t.Errorf("snapshot element [%d] = %v; want %v", i, x, before[i])
+		}
+	}
+	if q.Len() != 10 {
+		t.Errorf("Len() = %d; want 10", q.Len())
+	}
+	verify(t, q.q)
+}
@@ -0,0 +1,44 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "time"
+
+// Deadline is a ready-made element that is ordered by time,
+// earliest first, and carries an arbitrary payload.
+// It keeps track of its index, so it can be used with Remove, Fix
+// and FixElement:
+//
+//	q.Push(&prio.Deadline{At: t, Payload: p})
+type Deadline struct {
+	At      time.Time
+	Payload any
+	index   int
+}
+
+// Less reports whether d is earlier than x, which must be a *Deadline.
+func (d *Deadline) Less(x Interface) bool { return d.At.Before(x.(*Deadline).At) }
+
+// Index records the index of d in the queue.
+func (d *Deadline) Index(i int) { d.index = i }
+
+// HeapIndex returns the index of d in the queue, or -1 if it has been removed.
+func (d *Deadline) HeapIndex() int { return d.index }
+
+// PopPayload pops the earliest element from q, which must hold only *Deadline
+// elements, and returns its payload.
+func PopPayload(q *Queue) any {
+	return q.Pop().(*Deadline).Payload
+}
@@ -0,0 +1,43 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadline(t *testing.T) {
+	var q Queue
+	t0 := time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := make([]*Deadline, 5)
+	for i, k := range []int{3, 0, 4, 1, 2} {
+		d[i] = &Deadline{At: t0.Add(time.Duration(k) * time.Minute), Payload: k}
+		q.Push(d[i])
+	}
+	for _, x := range d {
+		if i := x.HeapIndex(); q.h[i] != x {
+			t.Errorf("HeapIndex() = %d does not refer to the element", i)
+		}
+	}
+	for k := 0; k < 5; k++ {
+		if p := PopPayload(&q); p != k {
+			t.Errorf("PopPayload() = %v; want %d", p, k)
+		}
+	}
+	if d[0].HeapIndex() != -1 {
+		t.Errorf("HeapIndex() of popped element = %d; want -1", d[0].HeapIndex())
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "testing"
+
+// Queue operations that can be decoded from fuzz input.
+const (
+	opPush = iota
+	opPop
+	opRemove
+	opFix
+	numOps
+)
+
+// Decodes data into a sequence of operations on q and applies them,
+// calling check after each step. Every operation consumes two bytes:
+// the first selects the operation and the second is its argument.
+func runOps(data []byte, q *Queue, check func(op int)) {
+	for ; len(data) >= 2; data = data[2:] {
+		op, arg := int(data[0])%numOps, int(data[1])
+		n := q.Len()
+		switch {
+		case op == opPush:
+			q.Push(&myType{arg, -1})
+		case n == 0:
+			continue
+		case op == opPop:
+			q.Pop()
+		case op == opRemove:
+			q.Remove(arg % n)
+		case op == opFix:
+			i := (arg >> 4) % n
+			q.h[i].(*myType).value = arg & 0xf
+			q.Fix(i)
+		}
+		check(op)
+	}
+}
+
+func FuzzQueue(f *testing.F) {
+	f.Add([]byte{0, 5, 0, 3, 0, 9, 1, 0, 0, 1, 2, 1, 3, 0x12, 1, 0})
+	f.Add([]byte{0, 1, 0, 1, 0, 1, 3, 0xf0, 2, 0, 0, 7})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var q Queue
+		runOps(data, &q, func(op int) {
+			if err := q.Validate(); err != nil {
+				t.Fatalf("after op %d: %v", op, err)
+			}
+			for i := 0; i < q.Len(); i++ {
+				if index := q.h[i].(*myType).index; index != i {
+					t.Fatalf("after op %d: wrong index [%d] = %d", op, i, index)
+				}
+			}
+		})
+		prev := -1
+		for q.Len() > 0 {
+			x := q.Pop().(*myType).value
+			if x < prev {
+				t.Fatalf("Pop() got %d after %d; want non-decreasing", x, prev)
+			}
+			prev = x
+		}
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+// MergeSortedSlices merges slices, each sorted according to less,
+// into one new sorted slice. Equal elements keep their relative order,
+// with elements from earlier slices first.
+// The complexity is O(n*log(k)), where n is the total number of elements
+// and k = len(slices).
+func MergeSortedSlices(less func(a, b Interface) bool, slices ...[]Interface) []Interface {
+	n := 0
+	heads := make([]Interface, 0, len(slices))
+	for i, s := range slices {
+		n += len(s)
+		if len(s) > 0 {
+			heads = append(heads, &cursor{s, i, less})
+		}
+	}
+	out := make([]Interface, 0, n)
+	q := New(heads...)
+	for q.Len() > 0 {
+		c := q.h[0].(*cursor)
+		out = append(out, c.s[0])
+		if c.s = c.s[1:]; len(c.s) == 0 {
+			q.Pop()
+		} else {
+			q.Fix(0)
+		}
+	}
+	return out
+}
+
+// A cursor is the remaining part of one of the slices being merged,
+// ordered by its first element.
+type cursor struct {
+	s    []Interface
+	i    int // position of the slice among the inputs, to break ties
+	less func(a, b Interface) bool
+}
+
+func (c *cursor) Less(x Interface) bool {
+	d := x.(*cursor)
+	switch {
+	case c.less(c.s[0], d.s[0]):
+		return true
+	case c.less(d.s[0], c.s[0]):
+		return false
+	}
+	return c.i < d.i
+}
+
+func (c *cursor) Index(i int) {}
@@ -0,0 +1,44 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "testing"
+
+func TestMergeSortedSlices(t *testing.T) {
+	less := func(a, b Interface) bool { return a.(*myType).value < b.(*myType).value }
+	var slices [][]Interface
+	total := 0
+	for k := 0; k < 6; k++ {
+		var s []Interface
+		for i := 0; i < k*3; i++ {
+			s = append(s, &myType{i*(k+1) + k%3, k})
+		}
+		slices = append(slices, s)
+		total += len(s)
+	}
+	out := MergeSortedSlices(less, slices...)
+	if len(out) != total {
+		t.Fatalf("MergeSortedSlices() returned %d elements; want %d", len(out), total)
+	}
+	for i := 1; i < len(out); i++ {
+		x, y := out[i-1].(*myType), out[i].(*myType)
+		if x.value > y.value || x.value == y.value && x.index > y.index {
+			t.Errorf("[%d] = %v, [%d] = %v; want sorted, stable order", i-1, x, i, y)
+		}
+	}
+	if out := MergeSortedSlices(less); len(out) != 0 {
+		t.Errorf("MergeSortedSlices() with no input = %v; want empty", out)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+// MinMaxQueue represents a double-ended priority queue implemented as a min-max heap:
+// elements on even levels of the tree are smaller than their descendants,
+// and elements on odd levels are larger than their descendants.
+// Both a minimum and a maximum element can be removed in O(log(n)) time.
+// The zero value for MinMaxQueue is an empty queue ready to use.
+type MinMaxQueue struct {
+	h []Interface
+}
+
+// PushMinMax pushes the element x onto the queue.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *MinMaxQueue) PushMinMax(x Interface) {
+	n := len(q.h)
+	q.h = append(q.h, x)
+	x.Index(n)
+	q.up(n)
+}
+
+// PopMin removes a minimum element (according to Less) from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *MinMaxQueue) PopMin() Interface {
+	return q.remove(0)
+}
+
+// PopMax removes a maximum element (according to Less) from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *MinMaxQueue) PopMax() Interface {
+	return q.remove(q.maxIndex())
+}
+
+// PeekMin returns, but does not remove, a minimum element (according to Less) of the queue.
+func (q *MinMaxQueue) PeekMin() Interface {
+	return q.h[0]
+}
+
+// PeekMax returns, but does not remove, a maximum element (according to Less) of the queue.
+func (q *MinMaxQueue) PeekMax() Interface {
+	return q.h[q.maxIndex()]
+}
+
+// Len returns the number of elements in the queue.
+func (q *MinMaxQueue) Len() int {
+	return len(q.h)
+}
+
+// Returns the index of a maximum element, which is the root
+// or one of its children.
+func (q *MinMaxQueue) maxIndex() int {
+	switch n := len(q.h); {
+	case n == 1:
+		return 0
+	case n == 2 || q.h[2].Less(q.h[1]):
+		return 1
+	}
+	return 2
+}
+
+// Removes the element at index i, which must be the root or one of its children.
+func (q *MinMaxQueue) remove(i int) Interface {
+	h := q.h
+	n := len(h) - 1
+	x := h[i]
+	h[i], h[n] = h[n], nil
+	q.h = h[:n]
+	if i < n {
+		q.h[i].Index(i)
+		q.down(i)
+	}
+	x.Index(-1) // for safety
+	return x
+}
+
+// Reports whether h[i] should sort before h[j]; on max levels the order is reversed.
+func (q *MinMaxQueue) before(i, j int, min bool) bool {
+	if min {
+		return q.h[i].Less(q.h[j])
+	}
+	return q.h[j].Less(q.h[i])
+}
+
+func (q *MinMaxQueue) swap(i, j int) {
+	q.h[i], q.h[j] = q.h[j], q.h[i]
+	q.h[i].Index(i)
+	q.h[j].Index(j)
+}
+
+// Moves the element at position i towards the top of the heap to restore invariant.
+func (q *MinMaxQueue) up(i int) {
+	if i == 0 {
+		return
+	}
+	min := isMinLevel(i)
+	if p := (i - 1) / 2; q.before(p, i, min) {
+		q.swap(i, p)
+		i, min = p, !min
+	}
+	for i > 2 {
+		g := ((i-1)/2 - 1) / 2 // grandparent
+		if !q.before(i, g, min) {
+			break
+		}
+		q.swap(i, g)
+		i = g
+	}
+}
+
+// Moves the element at position i towards the bottom of the heap to restore invariant.
+func (q *MinMaxQueue) down(i int) {
+	min := isMinLevel(i)
+	n := len(q.h)
+	for {
+		c := firstChild(i, n, 2)
+		if c < 0 {
+			return
+		}
+		// Find the best of the children and grandchildren of i.
+		m := c
+		if c+1 < n && q.before(c+1, m, min) {
+			m = c + 1
+		}
+		grandchild := false
+		for _, k := range [2]int{c, c + 1} {
+			g := firstChild(k, n, 2)
+			if g < 0 {
+				break
+			}
+			for j := g; j < g+2 && j < n; j++ {
+				if q.before(j, m, min) {
+					m, grandchild = j, true
+				}
+			}
+		}
+		if !q.before(m, i, min) {
+			return
+		}
+		q.swap(m, i)
+		if !grandchild {
+			return
+		}
+		if p := (m - 1) / 2; q.before(p, m, min) {
+			q.swap(m, p)
+		}
+		i = m
+	}
+}
+
+// Reports whether index i is on an even level of the tree, counting the root as level 0.
+func isMinLevel(i int) bool {
+	level := 0
+	for i > 0 {
+		i = (i - 1) / 2
+		level++
+	}
+	return level%2 == 0
+}
@@ -0,0 +1,90 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import (
+	"sort"
+	"testing"
+)
+
+// Checks the min-max heap invariant and the index values.
+func verifyMinMax(t *testing.T, q *MinMaxQueue) {
+	for i := 1; i < len(q.h); i++ {
+		for a := (i - 1) / 2; ; a = (a - 1) / 2 {
+			if isMinLevel(a) && q.h[i].Less(q.h[a]) || !isMinLevel(a) && q.h[a].Less(q.h[i]) {
+				t.Errorf("min-max invariant invalidated [%d] = %v, ancestor [%d] = %v", i, q.h[i], a, q.h[a])
+			}
+			if a == 0 {
+				break
+			}
+		}
+		if index := q.h[i].(*myType).index; index != i {
+			t.Errorf("wrong index [%d] = %d", i, index)
+		}
+	}
+}
+
+func TestMinMaxQueue(t *testing.T) {
+	var q MinMaxQueue
+	var ref []int // sorted reference
+	lfsr := uint16(0xace1)
+	for step := 0; step < 500; step++ {
+		bit := (lfsr>>0 ^ lfsr>>2 ^ lfsr>>3 ^ lfsr>>5) & 1
+		lfsr = lfsr>>1 | bit<<15
+		switch op := lfsr % 5; {
+		case op < 3 || len(ref) == 0:
+			v := int(lfsr>>3) % 100
+			q.PushMinMax(&myType{v, -1})
+			ref = append(ref, v)
+			sort.Ints(ref)
+		case op == 3:
+			if x := q.PeekMin().(*myType).value; x != ref[0] {
+				t.Errorf("PeekMin() = %d; want %d", x, ref[0])
+			}
+			if x := q.PopMin().(*myType).value; x != ref[0] {
+				t.Errorf("PopMin() = %d; want %d", x, ref[0])
+			}
+			ref = ref[1:]
+		default:
+			last := ref[len(ref)-1]
+			if x := q.PeekMax().(*myType).value; x != last {
+				t.Errorf("PeekMax() = %d; want %d", x, last)
+			}
+			if x := q.PopMax().(*myType).value; x != last {
+				t.Errorf("PopMax() = %d; want %d", x, last)
+			}
+			ref = ref[:len(ref)-1]
+		}
+		verifyMinMax(t, &q)
+		if q.Len() != len(ref) {
+			t.Fatalf("Len() = %d; want %d", q.Len(), len(ref))
+		}
+	}
+	for i := 0; q.Len() > 0; i++ {
+		var x int
+		if i%2 == 0 {
+			x, ref = q.PopMin().(*myType).value, ref[1:]
+			if len(ref) > 0 && x > ref[0] {
+				t.Errorf("PopMin() = %d; want <= %d", x, ref[0])
+			}
+		} else {
+			x, ref = q.PopMax().(*myType).value, ref[:len(ref)-1]
+			if len(ref) > 0 && x < ref[len(ref)-1] {
+				t.Errorf("PopMax() = %d; want >= %d", x, ref[len(ref)-1])
+			}
+		}
+		verifyMinMax(t, &q)
+	}
+}
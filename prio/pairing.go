@@ -0,0 +1,145 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+// PairingQueue represents a priority queue implemented as a pairing heap.
+// Compared to Queue it offers Meld in O(1) time and DecreaseKey
+// in amortized O(1) time, at the cost of a node allocation per element.
+// The Index method of the elements is not called by a PairingQueue;
+// elements are instead identified by the *PairingNode returned by Push.
+// The zero value for PairingQueue is an empty queue ready to use.
+type PairingQueue struct {
+	root *PairingNode
+	n    int
+}
+
+// PairingNode holds an element of a PairingQueue.
+type PairingNode struct {
+	x       Interface
+	child   *PairingNode // leftmost child
+	sibling *PairingNode // next sibling to the right
+	prev    *PairingNode // previous sibling, or parent for a leftmost child
+}
+
+// Value returns the element held by the node.
+func (n *PairingNode) Value() Interface {
+	return n.x
+}
+
+// Push pushes the element x onto the queue and returns the node holding it.
+// The complexity is O(1).
+func (q *PairingQueue) Push(x Interface) *PairingNode {
+	n := &PairingNode{x: x}
+	q.root = link(q.root, n)
+	q.n++
+	return n
+}
+
+// Pop removes a minimum element (according to Less) from the queue and returns it.
+// The amortized complexity is O(log(n)), where n = q.Len().
+func (q *PairingQueue) Pop() Interface {
+	r := q.root
+	q.root = mergePairs(r.child)
+	q.n--
+	r.child = nil
+	return r.x
+}
+
+// Peek returns, but does not remove, a minimum element (according to Less) of the queue.
+func (q *PairingQueue) Peek() Interface {
+	return q.root.x
+}
+
+// Len returns the number of elements in the queue.
+func (q *PairingQueue) Len() int {
+	return q.n
+}
+
+// DecreaseKey reestablishes the heap ordering after the element of node n,
+// which must belong to the queue, has been changed to a smaller value.
+// Use Pop or a new Push for values that increase.
+// The amortized complexity is O(1).
+func (q *PairingQueue) DecreaseKey(n *PairingNode) {
+	if n == q.root {
+		return
+	}
+	if n.prev.child == n {
+		n.prev.child = n.sibling
+	} else {
+		n.prev.sibling = n.sibling
+	}
+	if n.sibling != nil {
+		n.sibling.prev = n.prev
+	}
+	n.prev, n.sibling = nil, nil
+	q.root = link(q.root, n)
+}
+
+// Meld moves all elements of p into q, leaving p empty.
+// The complexity is O(1).
+func (q *PairingQueue) Meld(p *PairingQueue) {
+	if p == q {
+		return
+	}
+	q.root = link(q.root, p.root)
+	q.n += p.n
+	p.root, p.n = nil, 0
+}
+
+// Links two detached trees and returns the root of the combined tree.
+func link(a, b *PairingNode) *PairingNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if b.x.Less(a.x) {
+		a, b = b, a
+	}
+	b.prev = a
+	b.sibling = a.child
+	if a.child != nil {
+		a.child.prev = b
+	}
+	a.child = b
+	return a
+}
+
+// Combines a list of sibling trees into one tree using the standard
+// two-pass strategy: link pairs left to right, then fold right to left.
+func mergePairs(x *PairingNode) *PairingNode {
+	var stack *PairingNode // linked via sibling, most recent pair first
+	for x != nil {
+		a, b := x, x.sibling
+		x = nil
+		if b != nil {
+			x = b.sibling
+			b.sibling, b.prev = nil, nil
+		}
+		a.sibling, a.prev = nil, nil
+		a = link(a, b)
+		a.sibling = stack
+		stack = a
+	}
+	var root *PairingNode
+	for stack != nil {
+		next := stack.sibling
+		stack.sibling = nil
+		root = link(root, stack)
+		stack = next
+	}
+	return root
+}
@@ -0,0 +1,87 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "testing"
+
+// Pops all elements of p and q and checks that they come out in the same order.
+func samePops(t *testing.T, p *PairingQueue, q *Queue) {
+	if p.Len() != q.Len() {
+		t.Errorf("Len() = %d; want %d", p.Len(), q.Len())
+	}
+	for i := 1; q.Len() > 0; i++ {
+		x := p.Peek().(*myType).value
+		y := p.Pop().(*myType).value
+		z := q.Pop().(*myType).value
+		if x != z || y != z {
+			t.Errorf("%d.th peek/pop got %d/%d; want %d", i, x, y, z)
+		}
+	}
+	if p.Len() != 0 {
+		t.Errorf("Len() = %d after draining; want 0", p.Len())
+	}
+}
+
+func TestPairingMeld(t *testing.T) {
+	var p PairingQueue
+	var q Queue
+	for k := 0; k < 10; k++ {
+		var r PairingQueue
+		for i := 0; i < 10; i++ {
+			x := &myType{(k*31 + i*17) % 50, 0}
+			r.Push(x)
+			q.Push(x)
+		}
+		p.Meld(&r)
+		if r.Len() != 0 {
+			t.Errorf("Len() = %d after Meld; want 0", r.Len())
+		}
+		if k%3 == 2 {
+			x := p.Pop().(*myType).value
+			y := q.Pop().(*myType).value
+			if x != y {
+				t.Errorf("Pop() got %d; want %d", x, y)
+			}
+		}
+	}
+	samePops(t, &p, &q)
+}
+
+func TestPairingDecreaseKey(t *testing.T) {
+	var p PairingQueue
+	var q Queue
+	a := make([]*myType, 50)
+	nodes := make([]*PairingNode, len(a))
+	for i := range a {
+		a[i] = &myType{(100+i*7%50)*64 + i, 0} // unique values
+		nodes[i] = p.Push(a[i])
+		q.Push(a[i])
+	}
+	for k := 0; k < 5; k++ {
+		for i := range a {
+			if (i+k)%4 == 0 && a[i].index >= 0 {
+				a[i].value -= (10 + i%13) * 64
+				p.DecreaseKey(nodes[i])
+				q.Fix(a[i].index)
+			}
+		}
+		x := p.Pop().(*myType).value
+		y := q.Pop().(*myType).value
+		if x != y {
+			t.Errorf("Pop() got %d; want %d", x, y)
+		}
+	}
+	samePops(t, &p, &q)
+}
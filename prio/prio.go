@@ -16,6 +16,19 @@
 // The queue can hold elements that implement the two methods of prio.Interface.
 package prio
 
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+	"time"
+	"unsafe"
+)
+
 /*
 A type that implements prio.Interface can be inserted into a priority queue.
 
@@ -39,15 +52,104 @@ in the heap, e.g. like this:
 */
 type Interface interface {
 	// Less returns whether this element should sort before element x.
+	// It should be a strict weak ordering: in particular, x.Less(x) should be false.
+	// The queue never compares an element at some index with itself,
+	// and a comparator that also returns true for equal elements,
+	// like <= instead of <, still yields elements in sorted order,
+	// but ties are then broken arbitrarily, even in a stable queue.
 	Less(x Interface) bool
 	// Index is called by the priority queue when this element is moved to index i.
 	Index(i int)
 }
 
+// Comparable is an optional interface for elements that can compare themselves
+// to another element in a single call. A stable queue uses Compare instead of
+// two calls to Less to detect ties. Compare must agree with Less.
+type Comparable interface {
+	Interface
+	// Compare returns a negative number, zero, or a positive number
+	// when this element sorts before, equal to, or after element x.
+	Compare(x Interface) int
+}
+
+// Indexed is an optional interface for elements that remember
+// the index most recently given to them by the Index method.
+type Indexed interface {
+	Interface
+	// HeapIndex returns the index most recently passed to Index.
+	HeapIndex() int
+}
+
+// ErrNotFound is returned when an element is not in the queue.
+var ErrNotFound = errors.New("prio: element not in queue")
+
 // Queue represents a priority queue.
 // The zero value for Queue is an empty queue ready to use.
 type Queue struct {
-	h []Interface
+	h      []Interface
+	seq    []uint64 // seq[i] is the push order of h[i] in a stable queue
+	next   uint64   // next sequence number in a stable queue
+	max    bool
+	stable bool
+	d      int // arity, where 0 means 2
+	count  bool
+	stats  Stats
+	quiet  bool // Index is not called, see clone
+	fixed  bool // the backing array must not be reallocated, see Wrap
+
+	onEvict func(x Interface)
+	onGrow  func(oldCap, newCap int)
+	alloc   func(minCap int) []Interface // see SetAllocator
+
+	kth     kthCache                  // see KthSmallestCached
+	boosts  []Interface               // effective priorities by index, or nil; see Boost
+	boosted int                       // number of boosted elements
+	equal   func(a, b Interface) bool // see SetEqual
+
+	hist     []Interface // ring buffer of popped elements, see History
+	histNext int         // position of the oldest entry once hist is full
+
+	debug bool // see Options.Debug
+}
+
+// A kthCache remembers the result of the last call to KthSmallestCached.
+// Every change to the queue invalidates it.
+type kthCache struct {
+	valid bool
+	k     int
+	x     Interface
+	ok    bool
+}
+
+// Options configures a queue created by NewWithOptions.
+type Options struct {
+	// Max makes the queue a max-heap: Pop and Peek return a maximum element.
+	Max bool
+	// Stable makes equal elements leave the queue in the order they entered it.
+	Stable bool
+	// Arity is the number of children of each node in the heap.
+	// Zero means 2, a binary heap.
+	Arity int
+	// Stats turns on the operation counts returned by Queue.Stats.
+	Stats bool
+	// History is the number of popped elements that Queue.History remembers.
+	// Zero turns the history off.
+	History int
+	// Debug makes the queue call Validate after every operation that changes
+	// it and panic if the heap invariant is broken. This catches faulty Less
+	// methods, and elements changed without a Fix, at the operation that
+	// exposes them. It costs O(n) per operation, so it is meant for tests
+	// and development.
+	Debug bool
+}
+
+// Stats holds the number of operations performed on a queue
+// created with the Stats option.
+type Stats struct {
+	Pushes  int
+	Pops    int
+	Removes int
+	Fixes   int
 }
 
 // New returns an initialized priority queue with the given elements.
@@ -55,8 +157,56 @@ type Queue struct {
 // the queue and hence might change the elements of x.
 // The complexity is O(n), where n = len(x).
 func New(x ...Interface) Queue {
-	q := Queue{x}
-	heapify(q.h)
+	q := Queue{h: x}
+	q.heapify()
+	return q
+}
+
+// NewWithOptions is like New, but returns a queue configured by opts.
+// It panics if opts.Arity is negative or 1.
+func NewWithOptions(opts Options, x ...Interface) Queue {
+	if opts.Arity < 0 || opts.Arity == 1 {
+		panic("prio: invalid arity")
+	}
+	q := Queue{
+		h:      x,
+		max:    opts.Max,
+		stable: opts.Stable,
+		d:      opts.Arity,
+		count:  opts.Stats,
+		debug:  opts.Debug,
+	}
+	if opts.History > 0 {
+		q.hist = make([]Interface, 0, opts.History)
+	}
+	if q.stable {
+		q.seq = make([]uint64, len(x), cap(x))
+		for i := range q.seq {
+			q.seq[i] = uint64(i)
+		}
+		q.next = uint64(len(x))
+	}
+	q.heapify()
+	if q.debug {
+		q.check("New")
+	}
+	return q
+}
+
+// NewDebug is like New, but returns a queue with the Debug option,
+// which validates the heap after every operation that changes it.
+func NewDebug(x ...Interface) Queue {
+	return NewWithOptions(Options{Debug: true}, x...)
+}
+
+// Wrap returns a queue that uses backing as its backing array and never
+// allocates another one: the elements of backing become the initial elements
+// of the queue, and cap(backing) is its fixed capacity. Push panics with
+// ErrFull if the queue is full; use TryPush to get an error instead.
+// The complexity is O(n), where n = len(backing).
+func Wrap(backing []Interface) *Queue {
+	q := &Queue{h: backing, fixed: true}
+	q.heapify()
 	return q
 }
 
@@ -64,48 +214,188 @@ func New(x ...Interface) Queue {
 // The complexity is O(log(n)), where n = q.Len().
 func (q *Queue) Push(x Interface) {
 	n := len(q.h)
-	q.h = append(q.h, x)
-	up(q.h, n) // x.Index(n) is done by up.
+	q.add(x)
+	q.up(n) // x.Index(n) is done by up.
+	if q.count {
+		q.stats.Pushes++
+	}
+	if q.debug {
+		q.check("Push")
+	}
+}
+
+// TryPush is like Push, but returns ErrFull instead of panicking
+// if the queue was created by Wrap and is full.
+func (q *Queue) TryPush(x Interface) error {
+	if q.fixed && len(q.h) == cap(q.h) {
+		return ErrFull
+	}
+	q.Push(x)
+	return nil
 }
 
 // Pop removes a minimum element (according to Less) from the queue and returns it.
+// For a max-heap it removes a maximum element.
 // The complexity is O(log(n)), where n = q.Len().
 func (q *Queue) Pop() Interface {
-	h := q.h
-	n := len(h) - 1
-	x := h[0]
-	h[0], h[n] = h[n], nil
-	h = h[:n]
+	n := len(q.h) - 1
+	x := q.h[0]
+	q.move(0, n)
 	if n > 0 {
-		down(h, 0) // h[0].Index(0) is done by down.
+		q.down(0) // h[0].Index(0) is done by down.
+	}
+	if !q.quiet {
+		x.Index(-1) // for safety
+	}
+	if q.count {
+		q.stats.Pops++
+	}
+	if q.hist != nil {
+		q.record(x)
+	}
+	if q.debug {
+		q.check("Pop")
 	}
-	q.h = h
-	x.Index(-1) // for safety
 	return x
 }
 
+// PopIf pops and returns a minimum element if cond returns true for it.
+// Otherwise, or if the queue is empty, the queue is not changed
+// and PopIf returns (nil, false).
+// The complexity is O(log(n)), where n = q.Len().
+func (q *Queue) PopIf(cond func(min Interface) bool) (Interface, bool) {
+	if len(q.h) == 0 || !cond(q.h[0]) {
+		return nil, false
+	}
+	return q.Pop(), true
+}
+
+// TransferMin pops a minimum element from q, pushes it onto dst and returns
+// it, and true. If q is empty, or dst was created by Wrap and is full,
+// neither queue is changed and it returns (nil, false).
+// The element is indexed for its position in dst.
+// The complexity is O(log(n) + log(m)), where n = q.Len() and m = dst.Len().
+func (q *Queue) TransferMin(dst *Queue) (Interface, bool) {
+	if len(q.h) == 0 || dst.fixed && len(dst.h) == cap(dst.h) {
+		return nil, false
+	}
+	x := q.Pop()
+	dst.Push(x)
+	return x, true
+}
+
+// PopPeek is like Pop, but also returns the new minimum element of the queue,
+// the one a following Peek would return. If the queue becomes empty,
+// newMin is nil and hasMore is false.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *Queue) PopPeek() (popped, newMin Interface, hasMore bool) {
+	popped = q.Pop()
+	if len(q.h) == 0 {
+		return popped, nil, false
+	}
+	return popped, q.h[0], true
+}
+
 // Peek returns, but does not remove, a minimum element (according to Less) of the queue.
+// For a max-heap it returns a maximum element.
 func (q *Queue) Peek() Interface {
 	return q.h[0]
 }
 
+// WouldChangeHead reports whether pushing x would strictly improve on the
+// element that Peek returns, that is, whether the queue is empty or x is Less
+// than the current head; for a max-heap, whether x is greater. An x equal to
+// the head is not counted, although in a queue that is not stable it does
+// become the new head when pushed; in a stable queue it goes after the head.
+// The complexity is O(1).
+func (q *Queue) WouldChangeHead(x Interface) bool {
+	if len(q.h) == 0 {
+		return true
+	}
+	head := q.effective(0)
+	if q.max {
+		return head.Less(x)
+	}
+	return x.Less(head)
+}
+
+// MinChangesOnPop reports whether a Pop would change the priority at the
+// head of the queue, i.e. whether the element that Peek would return after
+// a Pop is not equal to the current one. For a queue with one element it
+// returns true, since the queue becomes empty; for an empty queue it returns false.
+// The complexity is O(d), where d is the arity of the heap.
+func (q *Queue) MinChangesOnPop() bool {
+	if len(q.h) == 0 {
+		return false
+	}
+	c, end := q.children(0)
+	if c == end {
+		return true
+	}
+	j := c
+	for k := c + 1; k < end; k++ {
+		if q.less(k, j) {
+			j = k
+		}
+	}
+	return compare(q.effective(0), q.effective(j)) != 0
+}
+
 // Remove removes the element at index i from the queue and returns it.
 // The complexity is O(log(n)), where n = q.Len().
 func (q *Queue) Remove(i int) Interface {
-	h := q.h
-	n := len(h) - 1
-	x := h[i]
-	h[i], h[n] = h[n], nil
-	h = h[:n]
+	n := len(q.h) - 1
+	x := q.h[i]
+	q.move(i, n)
 	if i < n {
-		down(h, i) // h[i].Index(i) is done by down.
-		up(h, i)
+		q.down(i) // h[i].Index(i) is done by down.
+		q.up(i)
+	}
+	if !q.quiet {
+		x.Index(-1) // for safety
+	}
+	if q.count {
+		q.stats.Removes++
+	}
+	if q.debug {
+		q.check("Remove")
 	}
-	q.h = h
-	x.Index(-1) // for safety
 	return x
 }
 
+// PopMax removes a maximum element (according to Less) from a min-heap and
+// returns it, and true; for an empty queue it returns (nil, false).
+// A maximum is always a leaf, so only the leaves are searched.
+// For a max-heap it is the same as Pop.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) PopMax() (Interface, bool) {
+	n := len(q.h)
+	if n == 0 {
+		return nil, false
+	}
+	if q.max {
+		return q.Pop(), true
+	}
+	leaves := q.LeafIndices()
+	j := leaves[0]
+	for _, k := range leaves[1:] {
+		if q.less(j, k) {
+			j = k
+		}
+	}
+	return q.Remove(j), true
+}
+
+// PopAt is like Remove, but returns false instead of panicking
+// if i is not a valid index, that is, not in [0, q.Len()).
+// The complexity is O(log(n)), where n = q.Len().
+func (q *Queue) PopAt(i int) (Interface, bool) {
+	if i < 0 || i >= len(q.h) {
+		return nil, false
+	}
+	return q.Remove(i), true
+}
+
 // Len returns the number of elements in the queue.
 func (q *Queue) Len() int {
 	return len(q.h)
@@ -116,42 +406,1154 @@ func (q *Queue) Len() int {
 // but less expensive than, calling Remove(i) followed by a Push of the new value.
 // The complexity is O(log(n)) where n = q.Len().
 func (q *Queue) Fix(i int) {
-	up(q.h, i)
-	down(q.h, i)
+	q.kth.valid = false
+	q.up(i)
+	q.down(i)
+	if q.count {
+		q.stats.Fixes++
+	}
+	if q.debug {
+		q.check("Fix")
+	}
+}
+
+// Swap swaps the elements at indices i and j and calls Index for both,
+// but does not restore the heap ordering. The caller is responsible for
+// doing so, for instance by calling Fix for each of the two elements,
+// at its current index.
+func (q *Queue) Swap(i, j int) {
+	q.kth.valid = false
+	q.swap(i, j)
+	q.index(i)
+	q.index(j)
+}
+
+// FixElement is like Fix, but takes the changed element itself.
+// If x implements Indexed and its HeapIndex refers to x, that index is used;
+// otherwise, e.g. for a stale index, the queue is searched for x using IndexOf.
+// It returns ErrNotFound if x is not in the queue.
+// The complexity is O(log(n)) for a valid index and O(n) otherwise, where n = q.Len().
+func (q *Queue) FixElement(x Interface) error {
+	if y, ok := x.(Indexed); ok {
+		if i := y.HeapIndex(); i >= 0 && i < len(q.h) && q.h[i] == x {
+			q.Fix(i)
+			return nil
+		}
+	}
+	if i := q.IndexOf(x); i >= 0 {
+		q.Fix(i)
+		return nil
+	}
+	return ErrNotFound
+}
+
+// Cycle removes a minimum element from the queue and pushes x in its place,
+// using a single sift-down, and returns the removed element. The removed element
+// is the minimum before x is added, even if x is smaller. For an empty queue
+// Cycle just pushes x and returns nil. This keeps the length of a nonempty queue
+// constant, as needed for a fixed-size window over a stream.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *Queue) Cycle(x Interface) Interface {
+	q.kth.valid = false
+	if len(q.h) == 0 {
+		q.Push(x)
+		return nil
+	}
+	min := q.h[0]
+	q.unboost(0)
+	if q.onEvict != nil {
+		q.onEvict(min)
+	}
+	q.h[0] = x
+	if q.stable {
+		q.seq[0] = q.next
+		q.next++
+	}
+	q.down(0) // x.Index is done by down.
+	if !q.quiet {
+		min.Index(-1) // for safety
+	}
+	if q.count {
+		q.stats.Pops++
+		q.stats.Pushes++
+	}
+	if q.hist != nil {
+		q.record(min)
+	}
+	if q.debug {
+		q.check("Cycle")
+	}
+	return min
+}
+
+// DrainOlderThan pops all elements that are Less than cutoff and returns them
+// in the order they were popped. If the elements are ordered by time, these are
+// the elements older than cutoff. It stops at the first element that is not
+// Less than cutoff, so it is meant for min-heaps.
+// The complexity is O(k*log(n)), where k is the number of popped elements and n = q.Len().
+func (q *Queue) DrainOlderThan(cutoff Interface) []Interface {
+	var res []Interface
+	for len(q.h) > 0 && q.h[0].Less(cutoff) {
+		res = append(res, q.Pop())
+	}
+	return res
+}
+
+// DrainFunc pops the elements of the queue in sorted order and calls process
+// for each of them. It stops at the first error returned by process and
+// returns that error, leaving the remaining elements in the queue.
+// The element for which process failed has been popped and is not put back.
+// The complexity is O(n*log(n)), where n = q.Len(), plus the cost of process.
+func (q *Queue) DrainFunc(process func(x Interface) error) error {
+	for len(q.h) > 0 {
+		if err := process(q.Pop()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PopWeight pops elements in sorted order as long as the sum of their
+// weights stays within maxWeight, and returns them. The first element that
+// would exceed the budget stays in the queue. As an exception, if the
+// minimum element alone weighs more than maxWeight, it is popped and
+// returned by itself, so that repeated calls always make progress.
+// The complexity is O(k*log(n)), where k is the number of popped elements
+// and n = q.Len(), plus the cost of weight.
+func (q *Queue) PopWeight(maxWeight int64, weight func(x Interface) int64) []Interface {
+	var res []Interface
+	var sum int64
+	for len(q.h) > 0 {
+		w := weight(q.h[0])
+		if sum+w > maxWeight && len(res) > 0 {
+			break
+		}
+		res = append(res, q.Pop())
+		sum += w
+	}
+	return res
+}
+
+// DrainAggregate pops all elements in sorted order, folds combine over them,
+// starting with init, and returns the result. Unlike Reduce, combine sees
+// the elements in sorted order, and the queue is left empty.
+// The complexity is O(n*log(n)), where n = q.Len(), plus the cost of combine.
+func (q *Queue) DrainAggregate(init Interface, combine func(acc, x Interface) Interface) Interface {
+	acc := init
+	for len(q.h) > 0 {
+		acc = combine(acc, q.Pop())
+	}
+	return acc
+}
+
+// DrainBudget pops the elements of the queue in sorted order and calls
+// process for each of them, until the queue is empty or more than d has
+// elapsed since the call started, and returns the number of processed
+// elements. The budget is checked, using the monotonic clock, before each
+// pop, so a slow process call can overrun it. The remaining elements stay
+// in the queue.
+// The complexity is O(k*log(n)), where k is the result and n = q.Len(),
+// plus the cost of process.
+func (q *Queue) DrainBudget(d time.Duration, process func(x Interface)) int {
+	start := time.Now()
+	k := 0
+	for len(q.h) > 0 && time.Since(start) <= d {
+		process(q.Pop())
+		k++
+	}
+	return k
+}
+
+// WriteSorted pops all elements in sorted order and writes each of them to w
+// using encode. It stops at the first error returned by encode and returns it;
+// the remaining elements stay in the queue, as for DrainFunc.
+// The complexity is O(n*log(n)), where n = q.Len(), plus the cost of encoding.
+func (q *Queue) WriteSorted(w io.Writer, encode func(w io.Writer, x Interface) error) error {
+	return q.DrainFunc(func(x Interface) error { return encode(w, x) })
+}
+
+// ToSortedList pops all elements and returns them in a new list,
+// in the order they were popped. The queue is left empty.
+// The complexity is O(n*log(n)), where n = q.Len().
+func (q *Queue) ToSortedList() *list.List {
+	l := list.New()
+	for len(q.h) > 0 {
+		l.PushBack(q.Pop())
+	}
+	return l
+}
+
+// TakeAll removes all elements from the queue and returns them in heap order,
+// which is unspecified. It is faster than popping the elements one by one,
+// but they are not sorted. The returned slice is the former backing array
+// of the queue, which no longer references it, so later pushes allocate
+// a new one; use TakeAllCopy to keep the backing array in the queue.
+// A queue created by Wrap never allocates: it keeps its backing array,
+// so later pushes overwrite the returned slice.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) TakeAll() []Interface {
+	q.kth.valid = false
+	h := q.h
+	q.h, q.seq = nil, nil
+	if q.fixed {
+		q.h = h[:0]
+	}
+	q.boosts, q.boosted = nil, 0
+	if !q.quiet {
+		for _, x := range h {
+			x.Index(-1) // for safety
+		}
+	}
+	return h
+}
+
+// SplitTopK removes the k smallest elements from the queue and returns them
+// as a new queue with the same ordering and arity, leaving the remaining
+// elements in q. If k is larger than q.Len(), all elements are moved.
+// Both queues call Index for their own elements; boosts move with their
+// elements, while the other settings of q are not copied.
+// The complexity is O(k*log(n)), where n = q.Len().
+func (q *Queue) SplitTopK(k int) Queue {
+	k = min(max(k, 0), len(q.h))
+	p := Queue{h: make([]Interface, k), max: q.max, stable: q.stable, d: q.d}
+	if q.stable {
+		p.seq = make([]uint64, k)
+	}
+	onEvict := q.onEvict
+	q.onEvict = nil // the elements are moved, not evicted
+	for i := range p.h {
+		x := q.h[0]
+		if q.boosts != nil && q.boosts[0] != nil {
+			if p.boosts == nil {
+				p.boosts = make([]Interface, k)
+			}
+			p.boosts[i] = q.boosts[0]
+			p.boosted++
+		}
+		n := len(q.h) - 1
+		q.move(0, n)
+		if n > 0 {
+			q.down(0)
+		}
+		// The elements come out in order, which keeps p a heap.
+		p.h[i] = x
+		if p.stable {
+			p.seq[i] = uint64(i)
+		}
+		p.index(i)
+	}
+	q.onEvict = onEvict
+	p.next = uint64(k)
+	if q.debug {
+		q.check("SplitTopK")
+	}
+	return p
+}
+
+// MergeSorted pushes the elements of sorted onto the queue. The elements
+// must be sorted in the order they would be popped, ascending for a min-heap.
+// An empty queue takes the slice as it is, since a sorted array is a heap;
+// otherwise the elements are sifted up one by one, or the heap is rebuilt
+// if that is cheaper. The slice is not retained.
+// The complexity is O(m) for an empty queue, and O(min(m*log(n), n))
+// otherwise, where m = len(sorted) and n is the final length of q.
+func (q *Queue) MergeSorted(sorted []Interface) {
+	m := len(q.h)
+	q.grow(len(sorted))
+	for _, x := range sorted {
+		q.add(x)
+	}
+	switch k := len(sorted); {
+	case m == 0:
+		for i := range q.h {
+			q.index(i)
+		}
+	case k > m/4:
+		q.heapify()
+	default:
+		for i := m; i < len(q.h); i++ {
+			q.up(i)
+		}
+	}
+	if q.count {
+		q.stats.Pushes += len(sorted)
+	}
+	if q.debug {
+		q.check("MergeSorted")
+	}
+}
+
+// TakeAllCopy is like TakeAll, but returns a newly allocated slice and
+// keeps the cleared backing array for later pushes, so the result is never
+// overwritten by the queue. It suits queues that are refilled after being
+// emptied, including those created by Wrap, which keep their capacity.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) TakeAllCopy() []Interface {
+	h := slices.Clone(q.h)
+	q.kth.valid = false
+	clear(q.h)
+	q.h = q.h[:0]
+	if q.stable {
+		q.seq = q.seq[:0]
+	}
+	q.boosts, q.boosted = nil, 0
+	if !q.quiet {
+		for _, x := range h {
+			x.Index(-1) // for safety
+		}
+	}
+	return h
+}
+
+// UpdateAll calls update for every element of the queue, in heap order,
+// and then reestablishes the heap ordering once. The update function
+// may change the values of the elements, but must not change the queue.
+// This is cheaper than a Fix for every element when most elements change.
+// The complexity is O(n), where n = q.Len(), plus the cost of the updates.
+func (q *Queue) UpdateAll(update func(x Interface)) {
+	for _, x := range q.h {
+		update(x)
+	}
+	q.heapify()
+	if q.debug {
+		q.check("UpdateAll")
+	}
+}
+
+// Reindex calls Index(i) for the element at every index i, without changing
+// the order of the elements. Use it when the index values kept by the elements
+// have gone out of date, for instance after the elements were rearranged by
+// other means in a way that preserves the heap ordering.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) Reindex() {
+	for i := range q.h {
+		q.index(i)
+	}
+}
+
+// Reverse turns a min-heap into a max-heap, or a max-heap into a min-heap,
+// by reestablishing the heap ordering in the opposite direction.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) Reverse() {
+	q.max = !q.max
+	q.heapify()
+	if q.debug {
+		q.check("Reverse")
+	}
+}
+
+// Rearity changes the arity of the heap to d, where 0 means 2, as for the
+// Arity option, and reestablishes the heap ordering for the new tree shape.
+// It panics if d is negative or 1.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) Rearity(d int) {
+	if d < 0 || d == 1 {
+		panic("prio: invalid arity")
+	}
+	q.d = d
+	q.heapify()
+	if q.debug {
+		q.check("Rearity")
+	}
+}
+
+// Claim extends the queue by n slots and returns them, so that the caller
+// can fill them directly, for example while decoding, without an intermediate
+// slice. Every claimed slot must be filled with an element before Commit is
+// called; until then the queue must not be used in any other way.
+// The complexity is O(n), not counting a possible reallocation.
+func (q *Queue) Claim(n int) []Interface {
+	m := len(q.h)
+	q.grow(n)
+	for i := 0; i < n; i++ {
+		q.add(nil)
+	}
+	return q.h[m:]
+}
+
+// Commit reestablishes the heap ordering after slots obtained by Claim have been filled.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) Commit() {
+	q.heapify()
+	if q.debug {
+		q.check("Commit")
+	}
+}
+
+// Compact2 removes every element for which decide returns false and returns
+// the removed elements, in heap order, so that the caller can clean them up.
+// The remaining elements are rebuilt into a heap once, at the end.
+// The decide function must not change the queue.
+// The complexity is O(n), where n = q.Len(), plus the cost of decide.
+func (q *Queue) Compact2(decide func(x Interface) bool) []Interface {
+	removed := q.filter(func(i int) bool { return decide(q.h[i]) })
+	if q.debug {
+		q.check("Compact2")
+	}
+	return removed
+}
+
+// PruneExpired removes every element for which isExpired returns true,
+// wherever it is in the heap, and returns the removed elements in heap order
+// for cleanup. Unlike DrainOlderThan, it does not assume that expiry follows
+// the priority order. It is the complement of Compact2.
+// The complexity is O(n), where n = q.Len(), plus the cost of isExpired.
+func (q *Queue) PruneExpired(isExpired func(x Interface) bool) []Interface {
+	removed := q.filter(func(i int) bool { return !isExpired(q.h[i]) })
+	if q.debug {
+		q.check("PruneExpired")
+	}
+	return removed
+}
+
+// PruneWorseThan removes every element that is not better than bound, that is,
+// not Less than bound, or for a max-heap, not greater. It returns the removed
+// elements in heap order. In branch-and-bound search, with bound the best
+// solution found so far, this discards the nodes that cannot improve on it.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) PruneWorseThan(bound Interface) []Interface {
+	removed := q.filter(func(i int) bool {
+		if q.max {
+			return bound.Less(q.effective(i))
+		}
+		return q.effective(i).Less(bound)
+	})
+	if q.debug {
+		q.check("PruneWorseThan")
+	}
+	return removed
+}
+
+// Boost temporarily gives the element at index i the priority of to,
+// typically a higher one, and moves it to its new position.
+// The element keeps its identity: it is still the element that is popped,
+// and it is still told its index. This can model priority inheritance.
+// Restore reverts the boost. Boosting a boosted element replaces the boost.
+// The boost belongs to the position of the element, not to its value,
+// so equal elements can be boosted independently.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *Queue) Boost(i int, to Interface) {
+	if q.boosts == nil {
+		q.boosts = make([]Interface, len(q.h), cap(q.h))
+	}
+	if q.boosts[i] == nil {
+		q.boosted++
+	}
+	q.boosts[i] = to
+	q.Fix(i)
+}
+
+// Restore reverts a Boost of the element at index i, if any,
+// and moves the element back according to its own priority.
+// The complexity is O(log(n)), where n = q.Len().
+func (q *Queue) Restore(i int) {
+	q.unboost(i)
+	q.Fix(i)
+}
+
+// ReplaceBatch removes the out smallest elements from the queue,
+// then pushes all elements of in, and returns the removed elements
+// in the order they were popped. If in is large compared to the queue,
+// the heap is rebuilt once instead of pushing the elements one by one.
+// It panics, without changing the queue, if out is negative
+// or larger than q.Len(), or with ErrFull if the queue was created
+// by Wrap and the elements of in do not fit.
+// The complexity is O(out*log(n) + min(m*log(n), n+m)),
+// where n = q.Len() and m = len(in).
+func (q *Queue) ReplaceBatch(out int, in []Interface) []Interface {
+	if out < 0 || out > len(q.h) {
+		panic("prio: ReplaceBatch out of range")
+	}
+	if q.fixed && len(q.h)-out+len(in) > cap(q.h) {
+		panic(ErrFull)
+	}
+	popped := make([]Interface, out)
+	for i := range popped {
+		popped[i] = q.Pop()
+	}
+	if len(in) < q.Len()/4 {
+		for _, x := range in {
+			q.Push(x)
+		}
+		return popped
+	}
+	for _, x := range in {
+		q.add(x)
+	}
+	q.heapify()
+	if q.count {
+		q.stats.Pushes += len(in)
+	}
+	if q.debug {
+		q.check("ReplaceBatch")
+	}
+	return popped
+}
+
+// SetOnEvict sets a function that is called with every element that
+// Pop, Remove or Cycle removes from the queue, just before the queue drops
+// its reference to the element. It can, for instance, return pooled
+// elements to their pool. A nil f removes the hook.
+func (q *Queue) SetOnEvict(f func(x Interface)) {
+	q.onEvict = f
+}
+
+// SetOnGrow sets a function that is called whenever adding an element
+// makes the queue reallocate its backing array, after the new array is in place.
+// It helps to find unexpected growth and to tune preallocation.
+// A nil f removes the hook.
+func (q *Queue) SetOnGrow(f func(oldCap, newCap int)) {
+	q.onGrow = f
+}
+
+// SetAllocator sets a function that provides the backing arrays of the queue,
+// for instance from an arena. When the queue must grow, it calls alloc with
+// the needed capacity, which is at least twice the current one, copies its
+// elements into the returned slice and then drops the old backing array.
+// The returned slice must have at least that capacity; its length is ignored.
+// A nil alloc, the default, means that the queue allocates with append.
+func (q *Queue) SetAllocator(alloc func(minCap int) []Interface) {
+	q.alloc = alloc
+}
+
+// History returns the most recently popped elements, oldest first,
+// for a queue created with the History option; otherwise it returns nil.
+// Elements are recorded by Pop, and the functions that use it, and by Cycle.
+func (q *Queue) History() []Interface {
+	if len(q.hist) == 0 {
+		return nil
+	}
+	h := make([]Interface, 0, len(q.hist))
+	h = append(h, q.hist[q.histNext:]...)
+	return append(h, q.hist[:q.histNext]...)
+}
+
+// Stats returns the operation counts of a queue created with the Stats option.
+// For other queues it returns the zero value.
+func (q *Queue) Stats() Stats {
+	return q.stats
+}
+
+// StatsReset returns the operation counts like Stats and resets them to zero,
+// so that periodic readers get the counts since the previous call.
+func (q *Queue) StatsReset() Stats {
+	s := q.stats
+	q.stats = Stats{}
+	return s
+}
+
+// DeepClone returns a new queue with the same configuration as q that holds
+// copies of the elements of q, made by calling copy for each element.
+// The copies keep the heap positions of their originals and are told
+// their indices through Index, while the original elements are not touched.
+// The complexity is O(n), where n = q.Len(), plus the cost of the copies.
+func (q *Queue) DeepClone(copy func(x Interface) Interface) Queue {
+	c := *q
+	c.h = make([]Interface, len(q.h), cap(q.h))
+	c.boosts = slices.Clone(q.boosts) // the copies keep the boosts of their originals
+	for i, x := range q.h {
+		c.h[i] = copy(x)
+		c.index(i)
+	}
+	if q.stable {
+		c.seq = append([]uint64(nil), q.seq...)
+	}
+	c.stats = Stats{}
+	c.kth = kthCache{}
+	if q.hist != nil {
+		c.hist = make([]Interface, 0, cap(q.hist))
+		c.histNext = 0
+	}
+	return c
+}
+
+// MemStats returns the number of elements in the queue, the capacity
+// of its backing array, and the approximate number of bytes used by the
+// backing array. The elements themselves are not included in the byte count.
+func (q *Queue) MemStats() (elements int, backingCap int, bytesApprox uintptr) {
+	var x Interface
+	bytesApprox = unsafe.Sizeof(x) * uintptr(cap(q.h))
+	if q.stable {
+		bytesApprox += unsafe.Sizeof(q.next) * uintptr(cap(q.seq))
+	}
+	return len(q.h), cap(q.h), bytesApprox
+}
+
+// LoadFactor returns the fraction of the backing array that holds elements,
+// Len divided by the capacity, or 0 if the capacity is 0. A low value after
+// a burst means that memory could be reclaimed by rebuilding the queue.
+func (q *Queue) LoadFactor() float64 {
+	if cap(q.h) == 0 {
+		return 0
+	}
+	return float64(len(q.h)) / float64(cap(q.h))
+}
+
+// SetEqual sets the function used by IndexOf and Contains to compare elements.
+// A nil f, the default, means that elements are compared with ==.
+func (q *Queue) SetEqual(f func(a, b Interface) bool) {
+	q.equal = f
+}
+
+// IndexOf returns the index of an element of the queue that is equal to x,
+// or -1 if there is no such element. Elements are compared with the function
+// set by SetEqual, or with == by default.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) IndexOf(x Interface) int {
+	for i, y := range q.h {
+		if q.equal == nil && y == x || q.equal != nil && q.equal(y, x) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Contains reports whether the queue holds an element equal to x, as defined by IndexOf.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) Contains(x Interface) bool {
+	return q.IndexOf(x) >= 0
+}
+
+// IsHeap reports whether the elements of the queue are heap ordered according
+// to less, rather than according to the Less method of the elements.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) IsHeap(less func(a, b Interface) bool) bool {
+	h := q.h
+	for i := 1; i < len(h); i++ {
+		if less(h[i], h[q.parent(i)]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reduce folds f over the elements of the queue, starting with init,
+// and returns the result. The elements are visited in heap order,
+// which is unspecified, and the queue is not changed.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) Reduce(init Interface, f func(acc, x Interface) Interface) Interface {
+	acc := init
+	for _, x := range q.h {
+		acc = f(acc, x)
+	}
+	return acc
+}
+
+// OldestWaiting returns the element with the greatest age, as reported by age,
+// together with that age. It helps detect low-priority elements that starve.
+// For an empty queue it returns (nil, 0). The queue is not changed.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) OldestWaiting(age func(x Interface) time.Duration) (Interface, time.Duration) {
+	var oldest Interface
+	var max time.Duration
+	for _, x := range q.h {
+		if a := age(x); oldest == nil || a > max {
+			oldest, max = x, a
+		}
+	}
+	return oldest, max
+}
+
+// Range returns all elements x of the queue with lo <= x <= hi,
+// that is, elements where neither x.Less(lo) nor hi.Less(x) holds.
+// The elements are returned in heap order, which is unspecified.
+// Subtrees whose root lies beyond the bound in heap direction (hi for a min-heap,
+// lo for a max-heap) are skipped, since all their elements lie beyond it too.
+// While elements are boosted, the heap is not ordered by Less, and all
+// elements are checked. The queue is not changed.
+func (q *Queue) Range(lo, hi Interface) []Interface {
+	var res []Interface
+	prune := q.boosts == nil
+	q.walk(func(i int) bool {
+		x := q.h[i]
+		if prune && (!q.max && hi.Less(x) || q.max && x.Less(lo)) {
+			return false
+		}
+		if !x.Less(lo) && !hi.Less(x) {
+			res = append(res, x)
+		}
+		return true
+	})
+	return res
+}
+
+// Rank returns the number of elements in the queue that are Less than x,
+// which is the position x has, or would have, in sorted order.
+// Subtrees of a min-heap whose root is not Less than x are skipped,
+// unless elements are boosted. The queue is not changed.
+// The complexity is O(n) in the worst case, where n = q.Len(),
+// and proportional to the result for a min-heap.
+func (q *Queue) Rank(x Interface) int {
+	n := 0
+	q.walk(func(i int) bool {
+		if q.h[i].Less(x) {
+			n++
+			return true
+		}
+		return q.max || q.boosts != nil
+	})
+	return n
+}
+
+// CountFunc returns the number of elements x in the queue for which pred(x)
+// is true. If monotone is true, pred must hold for every element that sorts
+// before an element for which it holds, as "priority < threshold" does for
+// a min-heap; then the subtrees below an element for which pred is false
+// are skipped. Otherwise, or while elements are boosted, all elements
+// are checked.
+// The complexity is O(n), where n = q.Len(), and proportional to the result
+// for a monotone pred.
+func (q *Queue) CountFunc(pred func(x Interface) bool, monotone bool) int {
+	n := 0
+	prune := monotone && q.boosts == nil
+	q.walk(func(i int) bool {
+		if pred(q.h[i]) {
+			n++
+			return true
+		}
+		return !prune
+	})
+	return n
+}
+
+// WouldRank returns the position, counting from 0, that x would have in the
+// order the elements are popped if x were pushed now, without pushing it.
+// In a stable queue x goes after the elements equal to it; otherwise it is
+// counted as going before them. Unlike Rank, it also respects Max and Boost.
+// Only the subtrees whose root would be popped before x are visited.
+// The complexity is proportional to the result, and O(n) in the worst case,
+// where n = q.Len().
+func (q *Queue) WouldRank(x Interface) int {
+	n := 0
+	q.walk(func(i int) bool {
+		a, b := q.effective(i), x
+		if q.max {
+			a, b = b, a
+		}
+		if a.Less(b) || q.stable && !b.Less(a) {
+			n++
+			return true
+		}
+		return false
+	})
+	return n
+}
+
+// FindEqual returns the elements of the queue that are equal to probe,
+// that is, neither Less than probe nor greater, in heap order.
+// The subtrees whose root sorts after probe are skipped.
+// The queue is not changed.
+// The complexity is O(n) in the worst case, where n = q.Len(),
+// and proportional to the number of elements that sort before probe
+// or are equal to it.
+func (q *Queue) FindEqual(probe Interface) []Interface {
+	var res []Interface
+	q.walk(func(i int) bool {
+		a, b := q.effective(i), probe
+		if q.max {
+			a, b = b, a
+		}
+		if b.Less(a) {
+			return false // so are its descendants
+		}
+		if !a.Less(b) {
+			res = append(res, q.h[i])
+		}
+		return true
+	})
+	return res
+}
+
+// Validate checks the heap invariant and returns an error describing
+// the first violation found, or nil if the queue is a valid heap.
+// A violation means that an element has been changed without a call to Fix,
+// or that Less is not a strict weak ordering.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) Validate() error {
+	if q.stable && len(q.seq) != len(q.h) {
+		return fmt.Errorf("prio: %d sequence numbers for %d elements", len(q.seq), len(q.h))
+	}
+	if q.boosts != nil && len(q.boosts) != len(q.h) {
+		return fmt.Errorf("prio: %d boosts for %d elements", len(q.boosts), len(q.h))
+	}
+	for i := 1; i < len(q.h); i++ {
+		if p := q.parent(i); q.less(i, p) {
+			return fmt.Errorf("prio: heap invariant violated: [%d] = %v sorts before its parent [%d] = %v",
+				i, q.h[i], p, q.h[p])
+		}
+	}
+	return nil
+}
+
+// Sorted returns an iterator over the elements of the queue in the order
+// they would be popped. Each iteration works on its own copy of the heap,
+// taken when the iteration starts, so the queue is not changed, and an
+// iteration that stops early does not pay for the remaining elements.
+// Each step costs O(log(n)), where n = q.Len(), after an O(n) copy.
+func (q *Queue) Sorted() iter.Seq[Interface] {
+	return func(yield func(Interface) bool) {
+		c := q.clone()
+		for c.Len() > 0 {
+			if !yield(c.Pop()) {
+				return
+			}
+		}
+	}
+}
+
+// SortedSlice returns a new slice holding the elements of the queue in the
+// order they would be popped. Unlike Sorted, it materializes all elements
+// at once, which is handy for assertions on the whole queue.
+// The queue is not changed.
+// The complexity is O(n*log(n)), where n = q.Len().
+func (q *Queue) SortedSlice() []Interface {
+	c := q.clone()
+	s := make([]Interface, 0, len(q.h))
+	for c.Len() > 0 {
+		s = append(s, c.Pop())
+	}
+	return s
+}
+
+// MarshalPriorities returns key(x) for all elements x of the queue, in the
+// order they would be popped, in a compact binary form: each key is stored
+// as the varint-encoded difference from the previous key. It suits
+// checkpoints of queues whose elements can be rebuilt from their keys;
+// use LoadPriorities to restore them. The queue is not changed.
+// The complexity is O(n*log(n)), where n = q.Len().
+func (q *Queue) MarshalPriorities(key func(x Interface) int64) []byte {
+	var data []byte
+	var prev int64
+	for _, x := range q.SortedSlice() {
+		k := key(x)
+		data = binary.AppendVarint(data, k-prev)
+		prev = k
+	}
+	return data
+}
+
+// KthSmallestCached returns the element at position k, counting from 0,
+// in the order the elements would be popped, and true; or nil and false
+// if k is not in [0, q.Len()). The result is cached until the queue changes,
+// so repeated calls with the same k and no change in between take O(1) time.
+// Otherwise the complexity is O(n + k*log(n)), where n = q.Len().
+func (q *Queue) KthSmallestCached(k int) (Interface, bool) {
+	if q.kth.valid && q.kth.k == k {
+		return q.kth.x, q.kth.ok
+	}
+	var x Interface
+	ok := k >= 0 && k < len(q.h)
+	if ok {
+		c := q.clone()
+		for i := 0; i < k; i++ {
+			c.Pop()
+		}
+		x = c.h[0]
+	}
+	q.kth = kthCache{true, k, x, ok}
+	return x, ok
+}
+
+// NextPriorities returns key(x) for the next k elements x that would be popped,
+// in that order, or for all elements if the queue holds fewer than k.
+// The queue is not changed.
+// The complexity is O(n + k*log(n)), where n = q.Len().
+func (q *Queue) NextPriorities(k int, key func(x Interface) int64) []int64 {
+	k = min(k, len(q.h))
+	if k <= 0 {
+		return nil
+	}
+	c := q.clone()
+	keys := make([]int64, k)
+	for i := range keys {
+		keys[i] = key(c.Pop())
+	}
+	return keys
+}
+
+// SmallestK returns the k smallest elements of the queue, in the order they
+// would be popped, or all elements if the queue holds fewer than k.
+// The queue is not changed. Only the nodes that can hold one of the k
+// smallest elements are visited: a small auxiliary heap of candidate nodes
+// starts at the root, and each extracted node adds its children.
+// The complexity is O(k*log(k)), independent of q.Len(), for a binary heap.
+func (q *Queue) SmallestK(k int) []Interface {
+	k = min(k, len(q.h))
+	if k <= 0 {
+		return nil
+	}
+	res := make([]Interface, 0, k)
+	f := frontier{q: q, nodes: []int{0}}
+	for len(res) < k {
+		i := f.pop()
+		res = append(res, q.h[i])
+		first, end := q.children(i)
+		for c := first; c < end; c++ {
+			f.push(c)
+		}
+	}
+	return res
+}
+
+// PeekAhead returns the element that the (m+1)th Pop from now would return,
+// so PeekAhead(0) is Peek, and true; or nil and false if m is not in
+// [0, q.Len()). The queue is not changed.
+// The complexity is O(m*log(m)), as for SmallestK.
+func (q *Queue) PeekAhead(m int) (Interface, bool) {
+	if m < 0 || m >= len(q.h) {
+		return nil, false
+	}
+	return q.SmallestK(m + 1)[m], true
+}
+
+// Levels returns the elements of the heap grouped by tree level: level 0
+// holds the root, level 1 its children, and so on. With arity d, level k
+// holds d^k elements, except that the last level may be partial.
+// The result does not share memory with the queue, which is not changed.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) Levels() [][]Interface {
+	var levels [][]Interface
+	h := slices.Clone(q.h)
+	for size := 1; len(h) > 0; size *= q.arity() {
+		size = min(size, len(h))
+		levels = append(levels, h[:size:size])
+		h = h[size:]
+	}
+	return levels
+}
+
+// NextPopCost returns the largest number of levels that a Pop right now
+// could sift the new root down, which is the height of the heap after the
+// removal. Each level costs up to d comparisons for arity d, so this is a
+// cheap estimate of the cost of a Pop. The queue is not changed.
+// The complexity is O(log(n)), without any comparisons, where n = q.Len().
+func (q *Queue) NextPopCost() int {
+	n := len(q.h) - 1
+	levels := 0
+	for i := firstChild(0, n, q.arity()); i >= 0; i = firstChild(i, n, q.arity()) {
+		levels++
+	}
+	return levels
+}
+
+// IsComplete reports whether the backing array holds an element at every index
+// in [0, q.Len()), so that the heap forms a complete tree without holes.
+// This is always true for queues that are changed only through this package;
+// it is meant as a guard for code that manipulates the backing array directly.
+// The complexity is O(n), where n = q.Len().
+func (q *Queue) IsComplete() bool {
+	for _, x := range q.h {
+		if x == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// LeafIndices returns, in increasing order, the indices of the elements
+// that have no children in the heap. For a binary heap these are the
+// indices from q.Len()/2 up to q.Len()-1.
+func (q *Queue) LeafIndices() []int {
+	n := len(q.h)
+	first := 0
+	if n >= 2 {
+		first = (n-2)/q.arity() + 1
+	}
+	if first >= n {
+		return nil
+	}
+	leaves := make([]int, n-first)
+	for i := range leaves {
+		leaves[i] = first + i
+	}
+	return leaves
+}
+
+// DOT returns a description of the heap in the Graphviz DOT language,
+// with a node for every element, labeled by label, and an edge from every
+// node to each of its children. The queue is not changed.
+func (q *Queue) DOT(label func(x Interface) string) string {
+	var b strings.Builder
+	b.WriteString("digraph heap {\n")
+	for i, x := range q.h {
+		fmt.Fprintf(&b, "\tn%d [label=%q];\n", i, label(x))
+	}
+	for i := range q.h {
+		for c, end := q.children(i); c < end; c++ {
+			fmt.Fprintf(&b, "\tn%d -> n%d;\n", i, c)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// GroupByPriority returns the elements of the queue in the order they would be popped,
+// grouped so that each group holds a run of elements with equal priority,
+// i.e. elements where neither is Less than the other.
+// It returns nil for an empty queue. The queue itself is not changed.
+// The complexity is O(n*log(n)), where n = q.Len().
+func (q *Queue) GroupByPriority() [][]Interface {
+	c := q.clone()
+	var groups [][]Interface
+	for c.Len() > 0 {
+		x := c.Pop()
+		if k := len(groups) - 1; k >= 0 {
+			if compare(x, groups[k][0]) == 0 {
+				groups[k] = append(groups[k], x)
+				continue
+			}
+		}
+		groups = append(groups, []Interface{x})
+	}
+	return groups
+}
+
+// Calls visit for the positions of the heap in depth-first order,
+// skipping the descendants of positions for which visit returns false.
+func (q *Queue) walk(visit func(i int) bool) {
+	if len(q.h) == 0 {
+		return
+	}
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !visit(i) {
+			continue
+		}
+		for c, end := q.children(i); c < end; c++ {
+			stack = append(stack, c)
+		}
+	}
+}
+
+// Keeps the elements at the positions for which keep returns true,
+// reestablishes the heap ordering, and returns the other elements in heap order.
+// keep may look at any position that it has not been called for yet.
+func (q *Queue) filter(keep func(i int) bool) []Interface {
+	var removed []Interface
+	n := 0
+	for i, x := range q.h {
+		if !keep(i) {
+			removed = append(removed, x)
+			q.unboost(i)
+			continue
+		}
+		q.h[n] = x
+		if q.stable {
+			q.seq[n] = q.seq[i]
+		}
+		if q.boosts != nil {
+			q.boosts[n] = q.boosts[i]
+		}
+		n++
+	}
+	clear(q.h[n:])
+	q.h = q.h[:n]
+	if q.stable {
+		q.seq = q.seq[:n]
+	}
+	q.shrinkBoosts(n)
+	q.heapify()
+	if !q.quiet {
+		for _, x := range removed {
+			x.Index(-1) // for safety
+		}
+	}
+	if q.count {
+		q.stats.Removes += len(removed)
+	}
+	return removed
 }
 
 // Establishes the heap invariant in O(n) time.
-func heapify(h []Interface) {
-	n := len(h)
-	for i := n - 1; i >= n/2; i-- {
-		h[i].Index(i)
+func (q *Queue) heapify() {
+	q.kth.valid = false
+	i := len(q.h) - 1
+	for ; i >= 0 && q.firstChild(i) < 0; i-- {
+		q.index(i)
 	}
-	for i := n/2 - 1; i >= 0; i-- { // h[i].Index(i) is done by down.
-		down(h, i)
+	for ; i >= 0; i-- { // h[i].Index(i) is done by down.
+		q.down(i)
 	}
 }
 
 // Moves element at position i towards top of heap to restore invariant.
+// The sift routines only compare elements at distinct positions, so a Less
+// that is not strict, like <=, just moves equal elements more or less often;
+// the elements still come out in sorted order.
+func (q *Queue) up(i int) {
+	if q.plain() {
+		up(q.h, i)
+		return
+	}
+	for {
+		parent := q.parent(i)
+		if i == 0 || q.less(parent, i) {
+			q.index(i)
+			break
+		}
+		q.swap(parent, i)
+		q.index(i)
+		i = parent
+	}
+}
+
+// Moves element at position i towards bottom of heap to restore invariant.
+func (q *Queue) down(i int) {
+	if q.plain() {
+		down(q.h, i)
+		return
+	}
+	for {
+		c, end := q.children(i)
+		if c == end {
+			q.index(i)
+			break
+		}
+		j := c
+		for k := c + 1; k < end; k++ {
+			if q.less(k, j) {
+				j = k
+			}
+		}
+		if q.less(i, j) {
+			q.index(i)
+			break
+		}
+		q.swap(i, j)
+		q.index(i)
+		i = j
+	}
+}
+
+// Reports whether q is a binary min-heap ordered by Less alone that calls
+// Index, which up and down handle with the faster functions below.
+// Queues created by New without options are plain.
+func (q *Queue) plain() bool {
+	return q.d <= 2 && !q.max && !q.stable && q.boosts == nil && !q.quiet
+}
+
+// Moves element at position i towards top of a plain binary heap.
 func up(h []Interface, i int) {
 	for {
 		parent := (i - 1) / 2
 		if i == 0 || h[parent].Less(h[i]) {
-			h[i].Index(i)
 			break
 		}
 		h[parent], h[i] = h[i], h[parent]
 		h[i].Index(i)
 		i = parent
 	}
+	h[i].Index(i)
 }
 
-// Moves element at position i towards bottom of heap to restore invariant.
+// Moves element at position i towards bottom of a plain binary heap.
 func down(h []Interface, i int) {
+	n := len(h)
 	for {
-		n := len(h)
-		left := 2*i + 1
-		if left >= n || left < 0 { // left < 0 after int overflow
-			h[i].Index(i)
+		left := firstChild(i, n, 2)
+		if left < 0 {
 			break
 		}
 		j := left
@@ -159,11 +1561,556 @@ func down(h []Interface, i int) {
 			j = right
 		}
 		if h[i].Less(h[j]) {
-			h[i].Index(i)
 			break
 		}
 		h[i], h[j] = h[j], h[i]
 		h[i].Index(i)
 		i = j
 	}
+	h[i].Index(i)
+}
+
+// IsSortedPops reports whether popping all elements of q would yield them
+// in non-decreasing order according to less. It is meant for tests of code
+// that builds or changes queues. It works on a copy, so q is not changed.
+// The complexity is O(n*log(n)), where n = q.Len().
+func IsSortedPops(q *Queue, less func(a, b Interface) bool) bool {
+	c := q.clone()
+	var prev Interface
+	for c.Len() > 0 {
+		x := c.Pop()
+		if prev != nil && less(x, prev) {
+			return false
+		}
+		prev = x
+	}
+	return true
+}
+
+// CheckComparator checks that less is a strict ordering on samples: it must
+// be irreflexive, asymmetric and transitive. It returns an error describing
+// the first violation found, or nil. Running it on representative elements
+// catches comparator bugs that would otherwise silently corrupt a heap.
+// The complexity is O(n³), where n = len(samples), so keep samples small.
+func CheckComparator(samples []Interface, less func(a, b Interface) bool) error {
+	for _, a := range samples {
+		if less(a, a) {
+			return fmt.Errorf("prio: comparator not irreflexive: %v < %v", a, a)
+		}
+	}
+	for i, a := range samples {
+		for _, b := range samples[i+1:] {
+			if less(a, b) && less(b, a) {
+				return fmt.Errorf("prio: comparator not asymmetric: %v < %v and %v < %v", a, b, b, a)
+			}
+		}
+	}
+	for _, a := range samples {
+		for _, b := range samples {
+			if !less(a, b) {
+				continue
+			}
+			for _, c := range samples {
+				if less(b, c) && !less(a, c) {
+					return fmt.Errorf("prio: comparator not transitive: %v < %v and %v < %v, but not %v < %v",
+						a, b, b, c, a, c)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SamePopOrder reports whether popping all elements of a and of b would
+// yield equal elements in the same order. Elements are compared with the
+// function set by a.SetEqual, or with == by default. Note that the order
+// of equal elements is unspecified unless the queues are stable.
+// It is meant for tests; it works on copies, so a and b are not changed.
+// The complexity is O(n*log(n)), where n = a.Len() + b.Len().
+func SamePopOrder(a, b *Queue) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	ca, cb := a.clone(), b.clone()
+	for ca.Len() > 0 {
+		x, y := ca.Pop(), cb.Pop()
+		if a.equal == nil && x != y || a.equal != nil && !a.equal(x, y) {
+			return false
+		}
+	}
+	return true
+}
+
+// Coalesce combines all elements of q that have the same key into one
+// element, by repeatedly calling merge with the combined element so far
+// and the next element, and then rebuilds the heap. The merged element
+// may be one of its inputs or a new element. Index(-1) is called for every
+// element that is no longer in the queue, as if removed.
+// For a stable queue, a merged element is ordered as the oldest of its inputs.
+// The complexity is O(n), where n = q.Len(), plus the cost of key and merge.
+func Coalesce[K comparable](q *Queue, key func(x Interface) K, merge func(a, b Interface) Interface) {
+	pos := make(map[K]int)
+	m := len(q.h)
+	n := 0
+	for i, x := range q.h {
+		k := key(x)
+		j, ok := pos[k]
+		if !ok {
+			pos[k] = n
+			q.h[n] = x
+			if q.stable {
+				q.seq[n] = q.seq[i]
+			}
+			if q.boosts != nil {
+				q.boosts[n] = q.boosts[i]
+			}
+			n++
+			continue
+		}
+		y := q.h[j]
+		q.unboost(j)
+		q.unboost(i)
+		if !q.quiet {
+			// The survivors get their index back from heapify.
+			y.Index(-1)
+			x.Index(-1)
+		}
+		q.h[j] = merge(y, x)
+		if q.stable {
+			q.seq[j] = min(q.seq[j], q.seq[i])
+		}
+	}
+	clear(q.h[n:])
+	q.h = q.h[:n]
+	if q.stable {
+		q.seq = q.seq[:n]
+	}
+	q.shrinkBoosts(n)
+	q.heapify()
+	if q.count {
+		q.stats.Removes += m - n
+	}
+	if q.debug {
+		q.check("Coalesce")
+	}
+}
+
+// HasDuplicates returns the first key, in heap order, that key returns for
+// two elements of q, and true; or the zero key and false if all keys differ.
+// It helps to catch elements that were pushed twice by mistake.
+// The complexity is O(n), where n = q.Len(), plus the cost of key.
+func HasDuplicates[K comparable](q *Queue, key func(x Interface) K) (K, bool) {
+	seen := make(map[K]bool, len(q.h))
+	for _, x := range q.h {
+		k := key(x)
+		if seen[k] {
+			return k, true
+		}
+		seen[k] = true
+	}
+	var zero K
+	return zero, false
+}
+
+// InterleaveMaxRun is the largest number of consecutive elements that
+// Interleave takes from one queue while the other is not empty.
+const InterleaveMaxRun = 4
+
+// Interleave pops all elements of a and b and sends them on the returned
+// channel, which is closed when both queues are empty. It takes the smaller
+// of the two minimums, as ordered by a and preferring a on ties, except that after
+// InterleaveMaxRun consecutive elements from one queue it takes the next
+// element from the other, so that neither queue starves.
+// The queues are drained by a separate goroutine and must not be used
+// until the channel is closed; the caller must receive all elements.
+// The complexity is O(n*log(n)), where n = a.Len() + b.Len().
+func Interleave(a, b *Queue) <-chan Interface {
+	ch := make(chan Interface)
+	go func() {
+		defer close(ch)
+		var last *Queue
+		run := 0
+		for a.Len() > 0 || b.Len() > 0 {
+			from := a
+			switch {
+			case a.Len() == 0:
+				from = b
+			case b.Len() == 0:
+			case run == InterleaveMaxRun:
+				from = a
+				if last == a {
+					from = b
+				}
+			default:
+				// Compare the minimums as a orders its elements.
+				x, y := b.effective(0), a.effective(0)
+				if a.max {
+					x, y = y, x
+				}
+				if x.Less(y) {
+					from = b
+				}
+			}
+			if from == last {
+				run++
+			} else {
+				last, run = from, 1
+			}
+			ch <- from.Pop()
+		}
+	}()
+	return ch
+}
+
+// LoadPriorities returns a new queue holding build(k) for every key k
+// in data, which must have been returned by MarshalPriorities.
+// It panics if data is malformed.
+// The complexity is O(n), where n is the number of keys, plus the cost of build.
+func LoadPriorities(data []byte, build func(key int64) Interface) Queue {
+	var h []Interface
+	var k int64
+	for len(data) > 0 {
+		d, n := binary.Varint(data)
+		if n <= 0 {
+			panic("prio: malformed priority data")
+		}
+		data = data[n:]
+		k += d
+		h = append(h, build(k))
+	}
+	return New(h...)
+}
+
+// TopKFromFunc calls next until it returns false and returns the k smallest
+// of the elements it produced, according to Less, in sorted order, or all
+// of them if there are fewer than k. Only k elements are kept at a time,
+// in a max-heap whose top is replaced by every smaller element.
+// Index is not called for the elements. If k is not positive, next is not
+// called and the result is nil.
+// The complexity is O(m*log(k)), where m is the number of produced elements.
+func TopKFromFunc(k int, next func() (Interface, bool)) []Interface {
+	if k <= 0 {
+		return nil
+	}
+	top := Queue{max: true, quiet: true}
+	for {
+		x, ok := next()
+		if !ok {
+			break
+		}
+		switch {
+		case top.Len() < k:
+			top.Push(x)
+		case x.Less(top.h[0]):
+			top.Cycle(x)
+		}
+	}
+	res := make([]Interface, top.Len())
+	for i := len(res) - 1; i >= 0; i-- {
+		res[i] = top.Pop()
+	}
+	return res
+}
+
+// ReadInto decodes elements from r using decode and pushes them onto q,
+// until decode returns false, to signal the end of the input, or an error.
+// A decoding error is returned; the elements decoded before it stay in q.
+// If q was created by Wrap, ErrFull is returned for the first decoded
+// element that does not fit, which is dropped.
+// If many elements are read compared to the size of q, the heap is rebuilt
+// once at the end instead of pushing the elements one by one.
+// The complexity is O(min(k*log(n), n)), where k is the number of
+// decoded elements and n is the final length of q, plus the cost of decoding.
+func ReadInto(q *Queue, r io.Reader, decode func(r io.Reader) (Interface, bool, error)) error {
+	m := len(q.h)
+	var err error
+	for {
+		x, ok, e := decode(r)
+		if e != nil {
+			err = e
+			break
+		}
+		if !ok {
+			break
+		}
+		if q.fixed && len(q.h) == cap(q.h) {
+			err = ErrFull
+			break
+		}
+		q.add(x)
+	}
+	k := len(q.h) - m
+	if k > m/4 {
+		q.heapify()
+	} else {
+		for i := m; i < len(q.h); i++ {
+			q.up(i)
+		}
+	}
+	if q.count {
+		q.stats.Pushes += k
+	}
+	if q.debug {
+		q.check("ReadInto")
+	}
+	return err
+}
+
+// Returns a copy of q that shares the elements but not the heap.
+// The copy never calls Index, so it can be drained without disturbing
+// the index values that q has given to its elements.
+func (q *Queue) clone() Queue {
+	c := *q
+	c.h = append([]Interface(nil), q.h...)
+	if q.stable {
+		c.seq = append([]uint64(nil), q.seq...)
+	}
+	c.count = false
+	c.quiet = true
+	c.onEvict = nil
+	c.onGrow = nil
+	c.alloc = nil
+	c.boosts = slices.Clone(q.boosts)
+	c.hist = nil
+	c.debug = false
+	return c
+}
+
+// Panics if the heap is not valid after the operation op.
+func (q *Queue) check(op string) {
+	if err := q.Validate(); err != nil {
+		panic(fmt.Sprintf("%v, after %s", err, op))
+	}
+}
+
+// A binary heap of node indices of q, ordered like the nodes. SmallestK
+// uses it to find the next smallest element among the candidate nodes.
+type frontier struct {
+	q     *Queue
+	nodes []int
+}
+
+func (f *frontier) push(i int) {
+	f.nodes = append(f.nodes, i)
+	for j := len(f.nodes) - 1; j > 0; {
+		p := (j - 1) / 2
+		if !f.q.less(f.nodes[j], f.nodes[p]) {
+			break
+		}
+		f.nodes[j], f.nodes[p] = f.nodes[p], f.nodes[j]
+		j = p
+	}
+}
+
+func (f *frontier) pop() int {
+	h := f.nodes
+	i := h[0]
+	n := len(h) - 1
+	h[0] = h[n]
+	h = h[:n]
+	for j := 0; ; {
+		c := firstChild(j, n, 2)
+		if c < 0 {
+			break
+		}
+		if c+1 < n && f.q.less(h[c+1], h[c]) {
+			c++
+		}
+		if !f.q.less(h[c], h[j]) {
+			break
+		}
+		h[j], h[c] = h[c], h[j]
+		j = c
+	}
+	f.nodes = h
+	return i
+}
+
+// Appends x to the heap without restoring the heap invariant.
+func (q *Queue) add(x Interface) {
+	q.kth.valid = false
+	q.grow(1)
+	q.h = append(q.h, x)
+	if q.stable {
+		q.seq = append(q.seq, q.next)
+		q.next++
+	}
+	if q.boosts != nil {
+		q.boosts = append(q.boosts, nil)
+	}
+}
+
+// Makes room for n more elements in the backing array.
+func (q *Queue) grow(n int) {
+	c := cap(q.h)
+	if len(q.h)+n <= c {
+		return
+	}
+	if q.fixed {
+		panic(ErrFull)
+	}
+	if q.alloc != nil {
+		// Ask for at least double the capacity to keep pushes amortized O(1).
+		h := q.alloc(max(len(q.h)+n, 2*c))
+		if cap(h) < len(q.h)+n {
+			panic("prio: allocator returned a slice that is too small")
+		}
+		q.h = append(h[:0], q.h...)
+	} else {
+		q.h = slices.Grow(q.h, n)
+	}
+	if q.onGrow != nil {
+		q.onGrow(c, cap(q.h))
+	}
+}
+
+// Adds x to the history, replacing the oldest entry if the history is full.
+func (q *Queue) record(x Interface) {
+	if len(q.hist) < cap(q.hist) {
+		q.hist = append(q.hist, x)
+		return
+	}
+	q.hist[q.histNext] = x
+	q.histNext = (q.histNext + 1) % len(q.hist)
+}
+
+// Calls Index(i) on the element at position i.
+func (q *Queue) index(i int) {
+	if !q.quiet {
+		q.h[i].Index(i)
+	}
+}
+
+// Reports whether h[i] should sort before h[j] in this queue.
+func (q *Queue) less(i, j int) bool {
+	a, b := q.h[i], q.h[j]
+	if q.boosts != nil {
+		a, b = q.effective(i), q.effective(j)
+	}
+	if q.max {
+		a, b = b, a
+	}
+	if !q.stable {
+		return a.Less(b)
+	}
+	if c := compare(a, b); c != 0 {
+		return c < 0
+	}
+	return q.seq[i] < q.seq[j]
+}
+
+// Returns a negative number, zero, or a positive number when a sorts before,
+// equal to, or after b, using Compare if a implements Comparable.
+func compare(a, b Interface) int {
+	if c, ok := a.(Comparable); ok {
+		return c.Compare(b)
+	}
+	switch {
+	case a.Less(b):
+		return -1
+	case b.Less(a):
+		return 1
+	}
+	return 0
+}
+
+// Removes the boost at position i, if any. The boosts are dropped with the
+// last one, so that code that checks for boosts can take its faster path again.
+func (q *Queue) unboost(i int) {
+	if q.boosts == nil || q.boosts[i] == nil {
+		return
+	}
+	q.boosts[i] = nil
+	q.boosted--
+	if q.boosted == 0 {
+		q.boosts = nil
+	}
+}
+
+// Truncates the boosts to n positions after the heap has been compacted.
+func (q *Queue) shrinkBoosts(n int) {
+	if q.boosts == nil {
+		return
+	}
+	clear(q.boosts[n:])
+	q.boosts = q.boosts[:n]
+}
+
+// Returns the element whose priority the element at position i has
+// while it is boosted, or the element itself.
+func (q *Queue) effective(i int) Interface {
+	if q.boosts != nil && q.boosts[i] != nil {
+		return q.boosts[i]
+	}
+	return q.h[i]
+}
+
+// Swaps the elements at positions i and j, without calling Index.
+func (q *Queue) swap(i, j int) {
+	q.h[i], q.h[j] = q.h[j], q.h[i]
+	if q.stable {
+		q.seq[i], q.seq[j] = q.seq[j], q.seq[i]
+	}
+	if q.boosts != nil {
+		q.boosts[i], q.boosts[j] = q.boosts[j], q.boosts[i]
+	}
+}
+
+// Moves the last element, at position n, to position i and shrinks the heap by one.
+// The element at position i is dropped from the heap.
+func (q *Queue) move(i, n int) {
+	q.kth.valid = false
+	q.unboost(i)
+	if q.onEvict != nil {
+		q.onEvict(q.h[i])
+	}
+	q.h[i], q.h[n] = q.h[n], nil
+	q.h = q.h[:n]
+	if q.stable {
+		q.seq[i] = q.seq[n]
+		q.seq = q.seq[:n]
+	}
+	if q.boosts != nil {
+		q.boosts[i], q.boosts[n] = q.boosts[n], nil
+		q.boosts = q.boosts[:n]
+	}
+}
+
+func (q *Queue) arity() int {
+	if q.d == 0 {
+		return 2
+	}
+	return q.d
+}
+
+func (q *Queue) parent(i int) int {
+	return (i - 1) / q.arity()
+}
+
+func (q *Queue) firstChild(i int) int {
+	return firstChild(i, len(q.h), q.arity())
+}
+
+// Returns the range [first, end) of child indices of node i; it is empty for a leaf.
+func (q *Queue) children(i int) (first, end int) {
+	n := len(q.h)
+	first = q.firstChild(i)
+	if first < 0 {
+		return n, n
+	}
+	end = n
+	if d := q.arity(); d < n-first {
+		end = first + d
+	}
+	return
+}
+
+// Returns the index of the first child of node i in a d-ary heap with n elements,
+// or -1 if the node is a leaf. Testing i > (n-2)/d rather than d*i+1 >= n
+// avoids int overflow for very large heaps.
+func firstChild(i, n, d int) int {
+	if n < 2 || i > (n-2)/d {
+		return -1
+	}
+	return d*i + 1
 }
@@ -14,7 +14,17 @@
 
 package prio
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+)
 
 type myInt int
 
@@ -28,16 +38,17 @@ type myType struct {
 
 func (x *myType) Less(y Interface) bool { return x.value < y.(*myType).value }
 func (x *myType) Index(i int)           { x.index = i }
+func (x *myType) HeapIndex() int        { return x.index }
 
 // Verify the heap order.
 // For a queue with elements of type *myType, also check the index values.
 func verify(t *testing.T, q Queue) {
 	n := q.Len()
 	for i := 1; i < n; i++ {
-		p := (i - 1) / 2 // parent
+		p := q.parent(i)
 		qi := q.h[i]
 		qp := q.h[p]
-		if qi.Less(qp) {
+		if q.less(i, p) {
 			t.Errorf("heap invariant invalidated [%d] = %v < [%d] = %v", i, qi, p, qp)
 		}
 	}
@@ -191,3 +202,2308 @@ func TestFix(t *testing.T) {
 		verify(t, q)
 	}
 }
+
+func TestIsHeap(t *testing.T) {
+	q := New()
+	for i := 0; i < 20; i++ {
+		q.Push(myInt(i * 7 % 20))
+	}
+	less := func(a, b Interface) bool { return a.(myInt) < b.(myInt) }
+	if !q.IsHeap(less) {
+		t.Errorf("IsHeap(less) = false; want true")
+	}
+	greater := func(a, b Interface) bool { return a.(myInt) > b.(myInt) }
+	if q.IsHeap(greater) {
+		t.Errorf("IsHeap(greater) = true; want false")
+	}
+	always := func(a, b Interface) bool { return true }
+	if q.IsHeap(always) {
+		t.Errorf("IsHeap(always) = true; want false")
+	}
+	var empty Queue
+	if !empty.IsHeap(greater) {
+		t.Errorf("IsHeap on empty queue = false; want true")
+	}
+}
+
+func TestFirstChild(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		for i := 0; i < n; i++ {
+			want := 2*i + 1
+			if want >= n {
+				want = -1
+			}
+			if c := firstChild(i, n, 2); c != want {
+				t.Errorf("firstChild(%d, %d) = %d; want %d", i, n, c, want)
+			}
+		}
+	}
+
+	// Indices near the top of the int range must not overflow.
+	n := math.MaxInt
+	tests := []struct{ i, want int }{
+		{n/2 - 1, n - 2},
+		{n / 2, -1},
+		{n/2 + 1, -1},
+		{n - 1, -1},
+	}
+	for _, tt := range tests {
+		if c := firstChild(tt.i, n, 2); c != tt.want {
+			t.Errorf("firstChild(%d, MaxInt) = %d; want %d", tt.i, c, tt.want)
+		}
+	}
+	if c := firstChild(n/5+1, n, 5); c != -1 {
+		t.Errorf("firstChild(MaxInt/5+1, MaxInt, 5) = %d; want -1", c)
+	}
+}
+
+// An element with a priority and an identity, to check stability.
+type tagged struct {
+	prio, id int
+	index    int
+}
+
+func (x *tagged) Less(y Interface) bool { return x.prio < y.(*tagged).prio }
+func (x *tagged) Index(i int)           { x.index = i }
+
+func TestNewWithOptions(t *testing.T) {
+	a := make([]Interface, 30)
+	for i := range a {
+		a[i] = &tagged{i % 7, i, -1}
+	}
+	q := NewWithOptions(Options{Max: true, Stable: true, Arity: 3, Stats: true}, a[:10]...)
+	verify(t, q)
+	for _, x := range a[10:] {
+		q.Push(x)
+		verify(t, q)
+	}
+	for i := 0; i < q.Len(); i++ {
+		if c := q.firstChild(i); c >= 0 && c != 3*i+1 {
+			t.Errorf("firstChild(%d) = %d; want %d", i, c, 3*i+1)
+		}
+		if x := q.h[i].(*tagged); x.index != i {
+			t.Errorf("wrong index [%d] = %d", i, x.index)
+		}
+	}
+
+	prev := q.Pop().(*tagged)
+	for q.Len() > 0 {
+		x := q.Pop().(*tagged)
+		verify(t, q)
+		switch {
+		case x.prio > prev.prio:
+			t.Errorf("popped prio %d after %d; want descending", x.prio, prev.prio)
+		case x.prio == prev.prio && x.id < prev.id:
+			t.Errorf("popped id %d after %d for prio %d; want push order", x.id, prev.id, x.prio)
+		}
+		prev = x
+	}
+
+	want := Stats{Pushes: 20, Pops: 30}
+	if s := q.Stats(); s != want {
+		t.Errorf("Stats() = %+v; want %+v", s, want)
+	}
+}
+
+func TestGroupByPriority(t *testing.T) {
+	var q Queue
+	if g := q.GroupByPriority(); g != nil {
+		t.Errorf("GroupByPriority() on empty queue = %v; want nil", g)
+	}
+	for _, v := range []int{3, 1, 4, 1, 5, 9, 2, 6, 5, 3, 5} {
+		q.Push(&myType{v, 0})
+	}
+	g := q.GroupByPriority()
+	want := [][]int{{1, 1}, {2}, {3, 3}, {4}, {5, 5, 5}, {6}, {9}}
+	if len(g) != len(want) {
+		t.Fatalf("GroupByPriority() returned %d groups; want %d", len(g), len(want))
+	}
+	for i := range want {
+		if len(g[i]) != len(want[i]) {
+			t.Errorf("group %d has %d elements; want %d", i, len(g[i]), len(want[i]))
+			continue
+		}
+		for j, x := range g[i] {
+			if v := x.(*myType).value; v != want[i][j] {
+				t.Errorf("group %d element %d = %d; want %d", i, j, v, want[i][j])
+			}
+		}
+	}
+	if q.Len() != 11 {
+		t.Errorf("Len() = %d after GroupByPriority; want 11", q.Len())
+	}
+	verify(t, q)
+
+	q = New(myInt(7), myInt(7), myInt(7))
+	if g := q.GroupByPriority(); len(g) != 1 || len(g[0]) != 3 {
+		t.Errorf("GroupByPriority() of equal elements = %v; want one group of 3", g)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	q := New(myInt(5), myInt(3), myInt(8), myInt(1))
+	if err := q.Validate(); err != nil {
+		t.Errorf("Validate() = %v; want nil", err)
+	}
+	q.h[q.Len()-1] = myInt(0)
+	if err := q.Validate(); err == nil {
+		t.Errorf("Validate() of corrupted heap = nil; want error")
+	}
+}
+
+func TestReplaceBatch(t *testing.T) {
+	for _, m := range []int{0, 1, 3, 10, 50} {
+		var q Queue
+		for i := 0; i < 40; i++ {
+			q.Push(&myType{2 * i, 99})
+		}
+		in := make([]Interface, m)
+		for i := range in {
+			in[i] = &myType{(7*i)%100 + 1, 99}
+		}
+		out := q.ReplaceBatch(5, in)
+		verify(t, q)
+		if len(out) != 5 {
+			t.Errorf("m=%d: ReplaceBatch returned %d elements; want 5", m, len(out))
+		}
+		for i, x := range out {
+			if v := x.(*myType).value; v != 2*i {
+				t.Errorf("m=%d: popped[%d] = %d; want %d", m, i, v, 2*i)
+			}
+		}
+		if q.Len() != 35+m {
+			t.Errorf("m=%d: Len() = %d; want %d", m, q.Len(), 35+m)
+		}
+	}
+
+	w := Wrap([]Interface{myInt(4), myInt(2), myInt(3), myInt(6)})
+	func() {
+		defer func() {
+			if r := recover(); r != ErrFull || w.Len() != 4 {
+				t.Errorf("ReplaceBatch(1) over capacity: recover() = %v, Len() = %d; want ErrFull and 4", r, w.Len())
+			}
+		}()
+		w.ReplaceBatch(1, []Interface{myInt(5), myInt(1), myInt(0)})
+	}()
+	verify(t, *w)
+	if out := w.ReplaceBatch(2, []Interface{myInt(5), myInt(1)}); fmt.Sprint(out) != "[2 3]" {
+		t.Errorf("ReplaceBatch(2) on full Wrap queue = %v; want [2 3]", out)
+	}
+	verify(t, *w)
+
+	q := New(myInt(1), myInt(2))
+	defer func() {
+		if msg, _ := recover().(string); !strings.HasPrefix(msg, "prio: ") || q.Len() != 2 {
+			t.Errorf("ReplaceBatch(3) on 2 elements: recover() = %q, Len() = %d; want prio panic and 2", msg, q.Len())
+		}
+	}()
+	q.ReplaceBatch(3, nil)
+}
+
+func TestReduce(t *testing.T) {
+	var q Queue
+	sum := func(acc, x Interface) Interface { return acc.(myInt) + x.(myInt) }
+	if s := q.Reduce(myInt(0), sum); s != myInt(0) {
+		t.Errorf("Reduce on empty queue = %v; want 0", s)
+	}
+	for i := 1; i <= 10; i++ {
+		q.Push(myInt(i))
+	}
+	if s := q.Reduce(myInt(0), sum); s != myInt(55) {
+		t.Errorf("Reduce = %v; want 55", s)
+	}
+	if q.Len() != 10 {
+		t.Errorf("Len() = %d after Reduce; want 10", q.Len())
+	}
+	verify(t, q)
+}
+
+func TestDrainAggregate(t *testing.T) {
+	var q Queue
+	for i := 10; i > 0; i-- {
+		q.Push(myInt(i))
+	}
+	prev := myInt(0)
+	sum := q.DrainAggregate(myInt(0), func(acc, x Interface) Interface {
+		if x.(myInt) < prev {
+			t.Errorf("combine got %v after %v; want sorted order", x, prev)
+		}
+		prev = x.(myInt)
+		return acc.(myInt) + x.(myInt)
+	})
+	if sum != myInt(55) {
+		t.Errorf("DrainAggregate = %v; want 55", sum)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d after DrainAggregate; want 0", q.Len())
+	}
+	if s := q.DrainAggregate(myInt(7), nil); s != myInt(7) {
+		t.Errorf("DrainAggregate on empty queue = %v; want 7", s)
+	}
+}
+
+func TestRange(t *testing.T) {
+	for _, opts := range []Options{{}, {Max: true}, {Arity: 3}} {
+		a := make([]Interface, 200)
+		for i := range a {
+			a[i] = myInt(i * 37 % 101)
+		}
+		q := NewWithOptions(opts, append([]Interface(nil), a...)...)
+		for _, b := range [][2]int{{0, 100}, {10, 20}, {50, 50}, {90, 200}, {-5, 3}, {30, 20}} {
+			lo, hi := myInt(b[0]), myInt(b[1])
+			got := q.Range(lo, hi)
+			want := 0
+			for _, x := range a {
+				if x.(myInt) >= lo && x.(myInt) <= hi {
+					want++
+				}
+			}
+			if len(got) != want {
+				t.Errorf("%+v: Range(%d, %d) returned %d elements; want %d", opts, lo, hi, len(got), want)
+			}
+			for _, x := range got {
+				if x.(myInt) < lo || x.(myInt) > hi {
+					t.Errorf("%+v: Range(%d, %d) returned %d", opts, lo, hi, x)
+				}
+			}
+		}
+		verify(t, q)
+	}
+}
+
+func TestFixElement(t *testing.T) {
+	a := make([]*myType, 10)
+	q := Queue{}
+	for i := range a {
+		a[i] = &myType{i, 99}
+		q.Push(a[i])
+	}
+
+	a[7].value = -1
+	if err := q.FixElement(a[7]); err != nil {
+		t.Errorf("FixElement() = %v; want nil", err)
+	}
+	verify(t, q)
+	if q.Peek() != a[7] {
+		t.Errorf("Peek() = %v; want %v", q.Peek(), a[7])
+	}
+
+	// A stale index falls back to a search.
+	a[0].value = 20
+	a[0].index = 5
+	if err := q.FixElement(a[0]); err != nil {
+		t.Errorf("FixElement() with stale index = %v; want nil", err)
+	}
+	verify(t, q)
+
+	if err := q.FixElement(&myType{3, 3}); err != ErrNotFound {
+		t.Errorf("FixElement() of absent element = %v; want ErrNotFound", err)
+	}
+}
+
+func TestToSortedList(t *testing.T) {
+	q := NewWithOptions(Options{Stable: true})
+	for i := 0; i < 20; i++ {
+		q.Push(&myType{i * 7 % 5, 0})
+	}
+	want := q.SortedSlice()
+	l := q.ToSortedList()
+	if q.Len() != 0 || l.Len() != len(want) {
+		t.Fatalf("Len() = %d, list Len() = %d; want 0, %d", q.Len(), l.Len(), len(want))
+	}
+	i := 0
+	for e := l.Front(); e != nil; e = e.Next() {
+		if e.Value != want[i] {
+			t.Errorf("list element %d = %v; want %v", i, e.Value, want[i])
+		}
+		i++
+	}
+}
+
+func TestTakeAll(t *testing.T) {
+	a := make([]*myType, 10)
+	q := Queue{}
+	for i := range a {
+		a[i] = &myType{i * 3 % 10, 99}
+		q.Push(a[i])
+	}
+	all := q.TakeAll()
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d after TakeAll; want 0", q.Len())
+	}
+	if len(all) != len(a) {
+		t.Fatalf("TakeAll() returned %d elements; want %d", len(all), len(a))
+	}
+	seen := make(map[*myType]bool)
+	for _, x := range all {
+		seen[x.(*myType)] = true
+	}
+	for _, x := range a {
+		if !seen[x] {
+			t.Errorf("TakeAll() did not return %v", x)
+		}
+		if x.index != -1 {
+			t.Errorf("index of taken element = %d; want -1", x.index)
+		}
+	}
+	q.Push(myInt(1))
+	if q.Len() != 1 {
+		t.Errorf("Len() = %d after Push; want 1", q.Len())
+	}
+
+	w := Wrap(make([]Interface, 0, 4))
+	w.Push(myInt(1))
+	w.TakeAll()
+	for i := 0; i < 4; i++ {
+		if err := w.TryPush(myInt(i)); err != nil {
+			t.Errorf("TryPush() after TakeAll on Wrap queue = %v; want nil", err)
+		}
+	}
+}
+
+func TestComparable(t *testing.T) {
+	var n int
+	var p, q Queue
+	p = NewWithOptions(Options{Stable: true})
+	q = NewWithOptions(Options{Stable: true})
+	for i := 0; i < 100; i++ {
+		v := i * 37 % 10
+		p.Push(lessInt{v, &n})
+		q.Push(cmpInt{lessInt{v, &n}})
+		if err := q.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for q.Len() > 0 {
+		x, y := p.Pop().(lessInt), q.Pop().(cmpInt)
+		if x.v != y.v {
+			t.Errorf("Pop() with Compare got %d; want %d", y.v, x.v)
+		}
+	}
+}
+
+func TestOldestWaiting(t *testing.T) {
+	var q Queue
+	age := func(x Interface) time.Duration { return time.Duration(x.(*myType).value) * time.Second }
+	if x, d := q.OldestWaiting(age); x != nil || d != 0 {
+		t.Errorf("OldestWaiting() on empty queue = %v, %v; want nil, 0", x, d)
+	}
+	a := make([]*myType, 10)
+	for i := range a {
+		a[i] = &myType{i * 7 % 10, 99}
+		q.Push(a[i])
+	}
+	x, d := q.OldestWaiting(age)
+	if x != a[7] || d != 9*time.Second {
+		t.Errorf("OldestWaiting() = %v, %v; want %v, 9s", x, d, a[7])
+	}
+	verify(t, q)
+}
+
+func TestIsComplete(t *testing.T) {
+	var q Queue
+	if !q.IsComplete() {
+		t.Errorf("IsComplete() on empty queue = false; want true")
+	}
+	for i := 0; i < 10; i++ {
+		q.Push(myInt(i))
+	}
+	q.Pop()
+	if !q.IsComplete() {
+		t.Errorf("IsComplete() = false; want true")
+	}
+	q.h[4] = nil
+	if q.IsComplete() {
+		t.Errorf("IsComplete() with a nil hole = true; want false")
+	}
+}
+
+func TestTakeAllCopy(t *testing.T) {
+	backing := make([]Interface, 0, 8)
+	q := Wrap(backing)
+	for i := 8; i > 0; i-- {
+		q.Push(&myType{i, 0})
+	}
+	all := q.TakeAllCopy()
+	if q.Len() != 0 || len(all) != 8 {
+		t.Errorf("Len(), len(TakeAllCopy()) = %d, %d; want 0, 8", q.Len(), len(all))
+	}
+	want := fmt.Sprint(all)
+	for i := 0; i < 8; i++ {
+		if err := q.TryPush(&myType{100 + i, 0}); err != nil {
+			t.Fatalf("TryPush after TakeAllCopy = %v; want nil", err)
+		}
+	}
+	if got := fmt.Sprint(all); got != want {
+		t.Errorf("pushes changed the result of TakeAllCopy from %s to %s", want, got)
+	}
+	for _, x := range all {
+		if x.(*myType).index != -1 {
+			t.Errorf("index of taken element = %d; want -1", x.(*myType).index)
+		}
+	}
+	if &backing[:1][0] != &q.h[0] {
+		t.Errorf("TakeAllCopy did not keep the backing array")
+	}
+	verify(t, *q)
+}
+
+func TestUpdateAll(t *testing.T) {
+	q := BuildTestQueue(100)
+	var p Queue
+	for q.Len() > 0 {
+		p.Push(&myType{int(q.Pop().(myInt)), 99})
+	}
+	lfsr := uint16(0xace1)
+	p.UpdateAll(func(x Interface) {
+		bit := (lfsr>>0 ^ lfsr>>2 ^ lfsr>>3 ^ lfsr>>5) & 1
+		lfsr = lfsr>>1 | bit<<15
+		x.(*myType).value = int(lfsr % 50)
+	})
+	verify(t, p)
+	for prev := -1; p.Len() > 0; {
+		x := p.Pop().(*myType).value
+		if x < prev {
+			t.Errorf("Pop() got %d after %d; want ascending", x, prev)
+		}
+		prev = x
+	}
+}
+
+func TestCycle(t *testing.T) {
+	var q Queue
+	if x := q.Cycle(&myType{5, 99}); x != nil {
+		t.Errorf("Cycle() on empty queue = %v; want nil", x)
+	}
+	for i := 1; i < 10; i++ {
+		q.Push(&myType{5 + i, 99})
+	}
+	want := []int{5, 6, 7, 0, 8, 9, 10, 11, 12, 13}
+	for i, w := range want {
+		v := 20 + i
+		if i == 2 {
+			v = 0
+		}
+		x := q.Cycle(&myType{v, 99}).(*myType)
+		if x.value != w {
+			t.Errorf("%d.th Cycle() got %d; want %d", i, x.value, w)
+		}
+		if x.index != -1 {
+			t.Errorf("index of cycled element = %d; want -1", x.index)
+		}
+		if q.Len() != 10 {
+			t.Errorf("Len() = %d; want 10", q.Len())
+		}
+		verify(t, q)
+	}
+}
+
+func TestDeepClone(t *testing.T) {
+	a := make([]*myType, 10)
+	q := Queue{}
+	for i := range a {
+		a[i] = &myType{i * 3 % 10, 99}
+		q.Push(a[i])
+	}
+	c := q.DeepClone(func(x Interface) Interface {
+		y := *x.(*myType)
+		return &y
+	})
+	verify(t, c)
+
+	y := c.h[0].(*myType)
+	y.value = 100
+	c.Fix(0)
+	verify(t, c)
+	for c.Len() > 0 {
+		c.Pop()
+	}
+
+	verify(t, q)
+	for i, x := range a {
+		if x.value != i*3%10 {
+			t.Errorf("original element %d changed to %d", i, x.value)
+		}
+		if x.index < 0 {
+			t.Errorf("original element %d lost its index", i)
+		}
+	}
+}
+
+func TestDeepCloneBoosted(t *testing.T) {
+	a := make([]*myType, 10)
+	var q Queue
+	for i := range a {
+		a[i] = &myType{2 * i, 99}
+		q.Push(a[i])
+	}
+	q.Boost(a[7].index, &myType{-1, 0})
+	c := q.DeepClone(func(x Interface) Interface {
+		y := *x.(*myType)
+		return &y
+	})
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() on deep clone = %v", err)
+	}
+	if c.boosted != 1 || q.boosted != 1 {
+		t.Errorf("boosts after DeepClone = %d, %d; want 1, 1", c.boosted, q.boosted)
+	}
+	if x := c.Pop().(*myType); x == a[7] || x.value != 14 {
+		t.Errorf("clone Pop() = %v; want a copy of %v", x, a[7])
+	}
+	if q.boosted != 1 || q.Peek() != a[7] {
+		t.Errorf("clone Pop() changed the boosts of the original")
+	}
+}
+
+func TestDOT(t *testing.T) {
+	q := New(myInt(3), myInt(1), myInt(2), myInt(5), myInt(4))
+	dot := q.DOT(func(x Interface) string { return fmt.Sprint(x) })
+	if !strings.HasPrefix(dot, "digraph heap {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("DOT() = %q; want a digraph", dot)
+	}
+	if n := strings.Count(dot, "[label="); n != 5 {
+		t.Errorf("DOT() has %d nodes; want 5", n)
+	}
+	if n := strings.Count(dot, "->"); n != 4 {
+		t.Errorf("DOT() has %d edges; want 4", n)
+	}
+	for _, s := range []string{`n0 [label="1"];`, "n0 -> n1;", "n0 -> n2;", "n1 -> n3;", "n1 -> n4;"} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("DOT() = %q; want it to contain %q", dot, s)
+		}
+	}
+}
+
+func TestLeafIndices(t *testing.T) {
+	for _, d := range []int{2, 3} {
+		for n := 0; n < 20; n++ {
+			a := make([]Interface, n)
+			for i := range a {
+				a[i] = myInt(i)
+			}
+			q := NewWithOptions(Options{Arity: d}, a...)
+			var want []int
+			for i := 0; i < n; i++ {
+				if d*i+1 >= n {
+					want = append(want, i)
+				}
+			}
+			got := q.LeafIndices()
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("d=%d, n=%d: LeafIndices() = %v; want %v", d, n, got, want)
+			}
+		}
+	}
+}
+
+// A faulty element type whose Less is not strict.
+type leqInt int
+
+func (x leqInt) Less(y Interface) bool { return x <= y.(leqInt) }
+func (x leqInt) Index(i int)           {}
+
+func TestNonStrictLess(t *testing.T) {
+	for _, opts := range []Options{{}, {Stable: true}, {Max: true}} {
+		// The heap must be ordered by the strict order that Less approximates.
+		less := func(a, b Interface) bool { return a.(leqInt) < b.(leqInt) }
+		if opts.Max {
+			less = func(a, b Interface) bool { return b.(leqInt) < a.(leqInt) }
+		}
+		q := NewWithOptions(opts)
+		for i := 0; i < 100; i++ {
+			q.Push(leqInt(i * 7 % 10))
+			if !q.IsHeap(less) {
+				t.Fatalf("%+v: IsHeap() = false after %d pushes; want true", opts, i+1)
+			}
+		}
+		// Validate checks with Less itself, so it reports the ties.
+		if err := q.Validate(); err == nil {
+			t.Errorf("%+v: Validate() = nil; want an error for the non-strict Less", opts)
+		}
+		prev := q.Pop().(leqInt)
+		for q.Len() > 0 {
+			x := q.Pop().(leqInt)
+			if !opts.Max && x < prev || opts.Max && x > prev {
+				t.Errorf("%+v: Pop() got %d after %d", opts, x, prev)
+			}
+			prev = x
+		}
+	}
+}
+
+func TestPopPeek(t *testing.T) {
+	q := New(myInt(3), myInt(1), myInt(2))
+	for i := 1; i <= 3; i++ {
+		x, min, more := q.PopPeek()
+		if x != myInt(i) {
+			t.Errorf("%d.th PopPeek() popped %v; want %d", i, x, i)
+		}
+		switch {
+		case i < 3 && (min != myInt(i+1) || !more):
+			t.Errorf("%d.th PopPeek() = _, %v, %v; want %d, true", i, min, more, i+1)
+		case i == 3 && (min != nil || more):
+			t.Errorf("last PopPeek() = _, %v, %v; want nil, false", min, more)
+		}
+	}
+}
+
+func TestReindex(t *testing.T) {
+	a := make([]*myType, 10)
+	q := Queue{}
+	for i := range a {
+		a[i] = &myType{i, 99}
+		q.Push(a[i])
+	}
+	for _, x := range a {
+		x.index = 99
+	}
+	before := append([]Interface(nil), q.h...)
+	q.Reindex()
+	verify(t, q)
+	for i, x := range q.h {
+		if x != before[i] {
+			t.Errorf("Reindex() moved element [%d]", i)
+		}
+	}
+}
+
+func TestMemStats(t *testing.T) {
+	q := New(make([]Interface, 0, 16)...)
+	for i := 0; i < 10; i++ {
+		q.Push(myInt(i))
+	}
+	n, c, b := q.MemStats()
+	if n != 10 || c != 16 {
+		t.Errorf("MemStats() = %d, %d, _; want 10, 16", n, c)
+	}
+	if want := 16 * 2 * unsafe.Sizeof(uintptr(0)); b != want {
+		t.Errorf("MemStats() bytes = %d; want %d", b, want)
+	}
+}
+
+func TestLoadFactor(t *testing.T) {
+	var q Queue
+	if f := q.LoadFactor(); f != 0 {
+		t.Errorf("LoadFactor() of empty queue = %v; want 0", f)
+	}
+	q = New(make([]Interface, 0, 16)...)
+	for i := 0; i < 12; i++ {
+		q.Push(myInt(i))
+	}
+	if f := q.LoadFactor(); f != 0.75 {
+		t.Errorf("LoadFactor() = %v; want 0.75", f)
+	}
+	for i := 0; i < 8; i++ {
+		q.Pop()
+	}
+	if f := q.LoadFactor(); f != 0.25 {
+		t.Errorf("LoadFactor() after Pop = %v; want 0.25", f)
+	}
+	for i := 0; i < 30; i++ {
+		q.Push(myInt(i))
+	}
+	if f := q.LoadFactor(); f <= 0 || f > 1 || f != float64(q.Len())/float64(cap(q.h)) {
+		t.Errorf("LoadFactor() after growth = %v", f)
+	}
+}
+
+func TestPopAt(t *testing.T) {
+	a := make([]*myType, 10)
+	q := Queue{}
+	for i := range a {
+		a[i] = &myType{i, 99}
+		q.Push(a[i])
+	}
+	for _, i := range []int{-1, 10, 100} {
+		if x, ok := q.PopAt(i); x != nil || ok {
+			t.Errorf("PopAt(%d) = %v, %v; want nil, false", i, x, ok)
+		}
+	}
+	for _, k := range []int{7, 3, 0, 9} {
+		x, ok := q.PopAt(a[k].index)
+		if x != a[k] || !ok {
+			t.Errorf("PopAt() = %v, %v; want %v, true", x, ok, a[k])
+		}
+		verify(t, q)
+	}
+	if q.Len() != 6 {
+		t.Errorf("Len() = %d; want 6", q.Len())
+	}
+}
+
+func TestSetOnEvict(t *testing.T) {
+	var evicted []Interface
+	q := New()
+	q.SetOnEvict(func(x Interface) { evicted = append(evicted, x) })
+	for i := 10; i > 0; i-- {
+		q.Push(myInt(i))
+	}
+	var want []Interface
+	want = append(want, q.Pop(), q.Pop())
+	want = append(want, q.Remove(q.Len()-1))
+	want = append(want, q.Cycle(myInt(0)))
+	q.GroupByPriority() // must not evict
+	if fmt.Sprint(evicted) != fmt.Sprint(want) {
+		t.Errorf("evicted %v; want %v", evicted, want)
+	}
+	q.SetOnEvict(nil)
+	q.Pop()
+	if len(evicted) != len(want) {
+		t.Errorf("hook called after it was removed")
+	}
+}
+
+func TestRank(t *testing.T) {
+	for _, opts := range []Options{{}, {Max: true}} {
+		a := make([]Interface, 100)
+		for i := range a {
+			a[i] = myInt(i * 37 % 50)
+		}
+		q := NewWithOptions(opts, append([]Interface(nil), a...)...)
+		for probe := -1; probe <= 51; probe++ {
+			want := 0
+			for _, x := range a {
+				if x.(myInt) < myInt(probe) {
+					want++
+				}
+			}
+			if r := q.Rank(myInt(probe)); r != want {
+				t.Errorf("%+v: Rank(%d) = %d; want %d", opts, probe, r, want)
+			}
+		}
+		verify(t, q)
+	}
+}
+
+func TestRankRangeBoosted(t *testing.T) {
+	a := make([]*myType, 15)
+	var q Queue
+	for i := range a {
+		a[i] = &myType{10 * i, 0}
+		q.Push(a[i])
+	}
+	// The boosted element becomes the root, above elements it is not Less than.
+	q.Boost(a[14].index, &myType{-1, 0})
+	if r := q.Rank(&myType{35, 0}); r != 4 {
+		t.Errorf("Rank(35) with boost = %d; want 4", r)
+	}
+	if r := q.Range(&myType{0, 0}, &myType{35, 0}); len(r) != 4 {
+		t.Errorf("Range(0, 35) with boost = %v; want 4 elements", r)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	a := make([]*myType, 20)
+	q := Queue{}
+	for i := range a {
+		a[i] = &myType{i * 7 % 20, 99}
+		q.Push(a[i])
+	}
+	q.Reverse()
+	verify(t, q)
+	for i := 19; i >= 10; i-- {
+		if x := q.Pop().(*myType).value; x != i {
+			t.Errorf("Pop() after Reverse got %d; want %d", x, i)
+		}
+		verify(t, q)
+	}
+	q.Reverse()
+	verify(t, q)
+	for i := 0; q.Len() > 0; i++ {
+		if x := q.Pop().(*myType).value; x != i {
+			t.Errorf("Pop() after second Reverse got %d; want %d", x, i)
+		}
+	}
+}
+
+func TestSorted(t *testing.T) {
+	a := make([]*myType, 20)
+	q := Queue{}
+	for i := range a {
+		a[i] = &myType{i * 7 % 20, 99}
+		q.Push(a[i])
+	}
+	i := 0
+	for x := range q.Sorted() {
+		if v := x.(*myType).value; v != i {
+			t.Errorf("Sorted() element %d = %d; want %d", i, v, i)
+		}
+		if i++; i == 5 {
+			break
+		}
+	}
+	if q.Len() != 20 {
+		t.Errorf("Len() = %d after Sorted; want 20", q.Len())
+	}
+	verify(t, q)
+
+	n := 0
+	for range q.Sorted() {
+		n++
+	}
+	if n != 20 {
+		t.Errorf("Sorted() yielded %d elements; want 20", n)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	a := make([]*myType, 10)
+	q := Queue{}
+	for i := range a {
+		a[i] = &myType{i, 99}
+		q.Push(a[i])
+	}
+	x, y := q.h[1], q.h[8]
+	q.Swap(1, 8)
+	if q.h[1] != y || q.h[8] != x {
+		t.Errorf("Swap(1, 8) did not swap the elements")
+	}
+	if x.(*myType).index != 8 || y.(*myType).index != 1 {
+		t.Errorf("Swap(1, 8) gave indices %d, %d; want 8, 1", x.(*myType).index, y.(*myType).index)
+	}
+	if q.Validate() == nil {
+		t.Errorf("Validate() after Swap = nil; want error")
+	}
+	q.Fix(x.(*myType).index)
+	q.Fix(y.(*myType).index)
+	verify(t, q)
+}
+
+func TestMinChangesOnPop(t *testing.T) {
+	var q Queue
+	if q.MinChangesOnPop() {
+		t.Errorf("MinChangesOnPop() on empty queue = true; want false")
+	}
+	for _, v := range []int{1, 1, 2, 3, 3, 3, 4} {
+		q.Push(myInt(v))
+	}
+	for q.Len() > 0 {
+		got := q.MinChangesOnPop()
+		x := q.Pop()
+		want := q.Len() == 0 || q.Peek() != x
+		if got != want {
+			t.Errorf("MinChangesOnPop() = %v before popping %v; want %v", got, x, want)
+		}
+	}
+
+	// Boosted elements count with their effective priority.
+	a := []*myType{{5, 0}, {7, 0}, {9, 0}}
+	for _, x := range a {
+		q.Push(x)
+	}
+	q.Boost(a[1].index, &myType{5, 0})
+	if q.MinChangesOnPop() {
+		t.Errorf("MinChangesOnPop() with a boost to the same priority = true; want false")
+	}
+}
+
+func TestWouldChangeHead(t *testing.T) {
+	for _, maxHeap := range []bool{false, true} {
+		q := NewWithOptions(Options{Max: maxHeap})
+		if !q.WouldChangeHead(myInt(5)) {
+			t.Errorf("max=%t: WouldChangeHead(5) on empty queue = false; want true", maxHeap)
+		}
+		for _, v := range []int{5, 3, 7} {
+			q.Push(myInt(v))
+		}
+		for v, want := range map[int]bool{2: !maxHeap, 3: false, 4: false, 7: false, 8: maxHeap} {
+			if got := q.WouldChangeHead(myInt(v)); got != want {
+				t.Errorf("max=%t: WouldChangeHead(%d) = %t; want %t", maxHeap, v, got, want)
+			}
+		}
+		if q.Len() != 3 {
+			t.Errorf("max=%t: WouldChangeHead changed Len() to %d", maxHeap, q.Len())
+		}
+	}
+}
+
+func TestDrainOlderThan(t *testing.T) {
+	var q Queue
+	for i := 0; i < 20; i++ {
+		q.Push(myInt(i * 7 % 20))
+	}
+	old := q.DrainOlderThan(myInt(8))
+	if len(old) != 8 {
+		t.Errorf("DrainOlderThan(8) returned %d elements; want 8", len(old))
+	}
+	for i, x := range old {
+		if x != myInt(i) {
+			t.Errorf("DrainOlderThan(8)[%d] = %v; want %d", i, x, i)
+		}
+	}
+	if q.Len() != 12 || q.Peek() != myInt(8) {
+		t.Errorf("Len(), Peek() = %d, %v; want 12, 8", q.Len(), q.Peek())
+	}
+	verify(t, q)
+	if old := q.DrainOlderThan(myInt(8)); old != nil {
+		t.Errorf("second DrainOlderThan(8) = %v; want nil", old)
+	}
+}
+
+func TestSetAllocator(t *testing.T) {
+	var q Queue
+	var asked []int
+	q.SetAllocator(func(minCap int) []Interface {
+		asked = append(asked, minCap)
+		return make([]Interface, minCap/2, minCap) // the length is ignored
+	})
+	for i := 20; i > 0; i-- {
+		q.Push(myInt(i))
+	}
+	if s := fmt.Sprint(asked); s != "[1 2 4 8 16 32]" {
+		t.Errorf("allocator asked for %v; want [1 2 4 8 16 32]", asked)
+	}
+	if q.Len() != 20 || cap(q.h) != 32 {
+		t.Errorf("Len(), cap = %d, %d; want 20, 32", q.Len(), cap(q.h))
+	}
+	verify(t, q)
+
+	q.SetAllocator(func(minCap int) []Interface { return nil })
+	for q.Len() < cap(q.h) {
+		q.Push(myInt(0))
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Push with a too small allocation did not panic")
+		}
+	}()
+	q.Push(myInt(0))
+}
+
+func TestSetOnGrow(t *testing.T) {
+	q := New(make([]Interface, 0, 4)...)
+	var grows [][2]int
+	q.SetOnGrow(func(oldCap, newCap int) {
+		if newCap != cap(q.h) {
+			t.Errorf("callback got newCap %d before the new array was in place", newCap)
+		}
+		grows = append(grows, [2]int{oldCap, newCap})
+	})
+	for i := 0; i < 4; i++ {
+		q.Push(myInt(i))
+	}
+	if len(grows) != 0 {
+		t.Errorf("callback called %d times within capacity; want 0", len(grows))
+	}
+	for i := 4; i < 20; i++ {
+		q.Push(myInt(i))
+	}
+	if len(grows) == 0 || grows[0][0] != 4 {
+		t.Fatalf("growth events = %v; want first growth from capacity 4", grows)
+	}
+	for i, g := range grows {
+		if g[1] <= g[0] || i > 0 && g[0] != grows[i-1][1] {
+			t.Errorf("growth event %d = %v; want increasing capacities", i, g)
+		}
+	}
+}
+
+func TestPopIf(t *testing.T) {
+	var q Queue
+	even := func(x Interface) bool { return x.(myInt)%2 == 0 }
+	if x, ok := q.PopIf(even); x != nil || ok {
+		t.Errorf("PopIf() on empty queue = %v, %v; want nil, false", x, ok)
+	}
+	q.Push(myInt(2))
+	q.Push(myInt(3))
+	if x, ok := q.PopIf(even); x != myInt(2) || !ok {
+		t.Errorf("PopIf() = %v, %v; want 2, true", x, ok)
+	}
+	if x, ok := q.PopIf(even); x != nil || ok {
+		t.Errorf("PopIf() = %v, %v; want nil, false", x, ok)
+	}
+	if q.Len() != 1 || q.Peek() != myInt(3) {
+		t.Errorf("PopIf() changed the queue when the condition failed")
+	}
+}
+
+func TestTransferMin(t *testing.T) {
+	var q Queue
+	dst := NewWithOptions(Options{Max: true})
+	for i := 0; i < 10; i++ {
+		q.Push(&myType{i * 3 % 10, 0})
+	}
+	for i := 0; i < 4; i++ {
+		x, ok := q.TransferMin(&dst)
+		if !ok || x.(*myType).value != i {
+			t.Errorf("TransferMin() = %v, %t; want %d, true", x, ok, i)
+		}
+		if dst.Peek() != x {
+			t.Errorf("dst.Peek() = %v; want %v", dst.Peek(), x)
+		}
+		verify(t, q)
+		verify(t, dst)
+	}
+	for _, r := range []*Queue{&q, &dst} {
+		for i, x := range r.h {
+			if x.(*myType).index != i {
+				t.Errorf("wrong index [%d] = %d", i, x.(*myType).index)
+			}
+		}
+	}
+	if q.Len() != 6 || dst.Len() != 4 {
+		t.Errorf("Len() = %d, %d; want 6, 4", q.Len(), dst.Len())
+	}
+	var empty Queue
+	if x, ok := empty.TransferMin(&dst); ok || dst.Len() != 4 {
+		t.Errorf("TransferMin() from empty queue = %v, %t; want nil, false", x, ok)
+	}
+
+	full := Wrap(make([]Interface, 0, 1))
+	full.Push(&myType{-1, 0})
+	if x, ok := q.TransferMin(full); ok || q.Len() != 6 || full.Len() != 1 {
+		t.Errorf("TransferMin() to full queue = %v, %t with Len() = %d, %d; want nil, false with 6, 1",
+			x, ok, q.Len(), full.Len())
+	}
+}
+
+func TestDrainFunc(t *testing.T) {
+	var q Queue
+	for i := 9; i >= 0; i-- {
+		q.Push(myInt(i))
+	}
+	errStop := fmt.Errorf("stop")
+	var seen []Interface
+	err := q.DrainFunc(func(x Interface) error {
+		seen = append(seen, x)
+		if x == myInt(4) {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("DrainFunc() = %v; want %v", err, errStop)
+	}
+	if fmt.Sprint(seen) != "[0 1 2 3 4]" {
+		t.Errorf("DrainFunc() processed %v; want [0 1 2 3 4]", seen)
+	}
+	if q.Len() != 5 || q.Peek() != myInt(5) {
+		t.Errorf("Len(), Peek() = %d, %v after failure; want 5, 5", q.Len(), q.Peek())
+	}
+	verify(t, q)
+	if err := q.DrainFunc(func(x Interface) error { return nil }); err != nil || q.Len() != 0 {
+		t.Errorf("DrainFunc() = %v with %d left; want nil with 0 left", err, q.Len())
+	}
+}
+
+func TestRearity(t *testing.T) {
+	a := make([]*myType, 50)
+	var q Queue
+	for i := range a {
+		a[i] = &myType{i * 13 % 50, 0}
+		q.Push(a[i])
+	}
+	for _, d := range []int{4, 3, 0, 8, 2} {
+		q.Rearity(d)
+		if q.arity() != max(d, 2) {
+			t.Errorf("arity() = %d after Rearity(%d)", q.arity(), d)
+		}
+		verify(t, q)
+		for i, x := range q.h {
+			if x.(*myType).index != i {
+				t.Errorf("Rearity(%d): wrong index [%d] = %d", d, i, x.(*myType).index)
+			}
+		}
+	}
+	q.Rearity(4)
+	for i := 0; q.Len() > 0; i++ {
+		if v := q.Pop().(*myType).value; v != i {
+			t.Errorf("Pop() = %d; want %d", v, i)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Rearity(1) did not panic")
+		}
+	}()
+	q.Rearity(1)
+}
+
+func TestClaim(t *testing.T) {
+	var q Queue
+	q.Push(&myType{5, 99})
+	s := q.Claim(10)
+	if len(s) != 10 || q.Len() != 11 {
+		t.Fatalf("Claim(10) returned %d slots, Len() = %d; want 10, 11", len(s), q.Len())
+	}
+	for i := range s {
+		s[i] = &myType{9 - i, 99}
+	}
+	q.Commit()
+	verify(t, q)
+	for i := 0; q.Len() > 0; i++ {
+		want := i
+		if i > 5 {
+			want = i - 1
+		}
+		if x := q.Pop().(*myType).value; x != want {
+			t.Errorf("%d.th pop got %d; want %d", i, x, want)
+		}
+	}
+}
+
+func TestKthSmallestCached(t *testing.T) {
+	var q Queue
+	for i := 0; i < 20; i++ {
+		q.Push(myInt(2 * (i * 7 % 20)))
+	}
+	if x, ok := q.KthSmallestCached(3); x != myInt(6) || !ok {
+		t.Errorf("KthSmallestCached(3) = %v, %v; want 6, true", x, ok)
+	}
+	if !q.kth.valid {
+		t.Errorf("result of KthSmallestCached(3) not cached")
+	}
+	if x, _ := q.KthSmallestCached(3); x != myInt(6) {
+		t.Errorf("cached KthSmallestCached(3) = %v; want 6", x)
+	}
+	q.Push(myInt(1))
+	if q.kth.valid {
+		t.Errorf("cache still valid after Push")
+	}
+	if x, _ := q.KthSmallestCached(3); x != myInt(4) {
+		t.Errorf("KthSmallestCached(3) after Push = %v; want 4", x)
+	}
+	q.Pop()
+	if x, _ := q.KthSmallestCached(3); x != myInt(6) {
+		t.Errorf("KthSmallestCached(3) after Pop = %v; want 6", x)
+	}
+	for _, k := range []int{-1, 20} {
+		if x, ok := q.KthSmallestCached(k); x != nil || ok {
+			t.Errorf("KthSmallestCached(%d) = %v, %v; want nil, false", k, x, ok)
+		}
+	}
+	verify(t, q)
+}
+
+func TestWrap(t *testing.T) {
+	var backing [8]Interface
+	backing[0], backing[1], backing[2] = myInt(5), myInt(2), myInt(7)
+	q := Wrap(backing[:3])
+	verify(t, *q)
+	for i := 0; i < 5; i++ {
+		if err := q.TryPush(myInt(10 + i)); err != nil {
+			t.Fatalf("TryPush() = %v; want nil", err)
+		}
+	}
+	if err := q.TryPush(myInt(0)); err != ErrFull {
+		t.Errorf("TryPush() on full queue = %v; want ErrFull", err)
+	}
+	if &q.h[0] != &backing[0] {
+		t.Errorf("queue no longer uses the wrapped array")
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != ErrFull {
+				t.Errorf("Push() on full queue panicked with %v; want ErrFull", r)
+			}
+		}()
+		q.Push(myInt(0))
+	}()
+	if x := q.Pop(); x != myInt(2) {
+		t.Errorf("Pop() = %v; want 2", x)
+	}
+	if err := q.TryPush(myInt(1)); err != nil {
+		t.Errorf("TryPush() after Pop = %v; want nil", err)
+	}
+	verify(t, *q)
+}
+
+func TestIsSortedPops(t *testing.T) {
+	less := func(a, b Interface) bool { return a.(myInt) < b.(myInt) }
+	q := BuildTestQueue(50)
+	if !IsSortedPops(&q, less) {
+		t.Errorf("IsSortedPops() = false; want true")
+	}
+	if q.Len() != 50 {
+		t.Errorf("Len() = %d after IsSortedPops; want 50", q.Len())
+	}
+	q.h[1], q.h[q.Len()-1] = q.h[q.Len()-1], q.h[1]
+	if IsSortedPops(&q, less) {
+		t.Errorf("IsSortedPops() of corrupted heap = true; want false")
+	}
+}
+
+func TestCompact2(t *testing.T) {
+	a := make([]*myType, 30)
+	q := NewWithOptions(Options{Stable: true})
+	for i := range a {
+		a[i] = &myType{i * 7 % 30, 99}
+		q.Push(a[i])
+	}
+	removed := q.Compact2(func(x Interface) bool { return x.(*myType).value%3 != 0 })
+	if len(removed) != 10 {
+		t.Errorf("Compact2() removed %d elements; want 10", len(removed))
+	}
+	for _, x := range removed {
+		if x := x.(*myType); x.value%3 != 0 || x.index != -1 {
+			t.Errorf("Compact2() removed %v", x)
+		}
+	}
+	if q.Len() != 20 {
+		t.Errorf("Len() = %d; want 20", q.Len())
+	}
+	verify(t, q)
+	if err := q.Validate(); err != nil {
+		t.Error(err)
+	}
+	for prev := -1; q.Len() > 0; {
+		x := q.Pop().(*myType).value
+		if x%3 == 0 || x < prev {
+			t.Errorf("Pop() got %d after %d", x, prev)
+		}
+		prev = x
+	}
+}
+
+func TestPruneExpired(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	expires := make(map[*myType]time.Time)
+	var q Queue
+	for i := 0; i < 40; i++ {
+		x := &myType{i * 13 % 40, 0}
+		// Expiry is unrelated to priority; one in three expires exactly now.
+		expires[x] = now.Add(time.Duration(i%3-1) * time.Minute)
+		q.Push(x)
+	}
+	expired := func(x Interface) bool { return !expires[x.(*myType)].After(now) }
+	removed := q.PruneExpired(expired)
+	for _, x := range removed {
+		if !expired(x) || x.(*myType).index != -1 {
+			t.Errorf("PruneExpired() removed %v", x)
+		}
+	}
+	if len(removed) != 27 || q.Len() != 13 {
+		t.Errorf("PruneExpired() removed %d, kept %d; want 27, 13", len(removed), q.Len())
+	}
+	verify(t, q)
+	for i, x := range q.h {
+		if expired(x) || x.(*myType).index != i {
+			t.Errorf("PruneExpired() kept %v at [%d]", x, i)
+		}
+	}
+}
+
+func TestPruneWorseThan(t *testing.T) {
+	for _, max := range []bool{false, true} {
+		q := NewWithOptions(Options{Max: max})
+		for i := 0; i < 50; i++ {
+			q.Push(&myType{i * 17 % 50, 0})
+		}
+		better := func(x Interface, bound int) bool {
+			if max {
+				return x.(*myType).value > bound
+			}
+			return x.(*myType).value < bound
+		}
+		for _, bound := range []int{40, 30, 30, 12} {
+			if max {
+				bound = 49 - bound
+			}
+			before := q.Len()
+			removed := q.PruneWorseThan(&myType{bound, 0})
+			for _, x := range removed {
+				if better(x, bound) {
+					t.Errorf("max=%t: PruneWorseThan(%d) removed %v", max, bound, x)
+				}
+			}
+			for _, x := range q.h {
+				if !better(x, bound) {
+					t.Errorf("max=%t: PruneWorseThan(%d) kept %v", max, bound, x)
+				}
+			}
+			if len(removed)+q.Len() != before {
+				t.Errorf("max=%t: PruneWorseThan(%d) lost elements", max, bound)
+			}
+			verify(t, q)
+		}
+		if q.Len() != 12 {
+			t.Errorf("max=%t: Len() = %d after pruning; want 12", max, q.Len())
+		}
+	}
+}
+
+func TestBoost(t *testing.T) {
+	a := make([]*myType, 10)
+	q := Queue{}
+	for i := range a {
+		a[i] = &myType{2 * i, 99}
+		q.Push(a[i])
+	}
+	q.Boost(a[6].index, &myType{-1, 0})
+	verify(t, q)
+	if q.Peek() != a[6] {
+		t.Errorf("Peek() = %v after Boost; want %v", q.Peek(), a[6])
+	}
+	q.Restore(a[6].index)
+	verify(t, q)
+	if q.Peek() != a[0] {
+		t.Errorf("Peek() = %v after Restore; want %v", q.Peek(), a[0])
+	}
+
+	q.Boost(a[8].index, &myType{1, 0})
+	for _, want := range []int{0, 8, 1, 2} {
+		if x := q.Pop(); x != a[want] {
+			t.Errorf("Pop() = %v; want %v", x, a[want])
+		}
+		verify(t, q)
+	}
+	if q.boosts != nil || !q.plain() {
+		t.Errorf("popped element is still boosted")
+	}
+
+	// An element that Cycle evicts must lose its boost as well.
+	q.Boost(a[9].index, &myType{1, 0})
+	if x := q.Cycle(&myType{100, 0}); x != a[9] {
+		t.Errorf("Cycle() = %v; want %v", x, a[9])
+	}
+	q.Push(a[9])
+	verify(t, q)
+	if q.Peek() != a[3] {
+		t.Errorf("Peek() = %v after Cycle and Push; want %v", q.Peek(), a[3])
+	}
+	if q.boosts != nil {
+		t.Errorf("cycled element is still boosted")
+	}
+}
+
+func TestBoostEqualElements(t *testing.T) {
+	q := New(myInt(1), myInt(5), myInt(2), myInt(6), myInt(7), myInt(5))
+	i := 1
+	if q.h[i] != myInt(5) {
+		t.Fatalf("h[%d] = %v; want 5", i, q.h[i])
+	}
+	q.Boost(i, myInt(0))
+	if err := q.Validate(); err != nil {
+		t.Fatalf("Validate() after Boost = %v", err)
+	}
+	var got []Interface
+	for q.Len() > 0 {
+		got = append(got, q.Pop())
+	}
+	// Only the boosted copy of 5 jumps ahead; the other keeps its place.
+	want := []Interface{myInt(5), myInt(1), myInt(2), myInt(5), myInt(6), myInt(7)}
+	if !slices.Equal(got, want) {
+		t.Errorf("Pop() order = %v; want %v", got, want)
+	}
+	if q.boosts != nil {
+		t.Errorf("boosts not dropped with the last boosted element")
+	}
+}
+
+func TestPopMax(t *testing.T) {
+	var q Queue
+	if x, ok := q.PopMax(); x != nil || ok {
+		t.Errorf("PopMax() on empty queue = %v, %v; want nil, false", x, ok)
+	}
+	a := make([]*myType, 30)
+	for i := range a {
+		a[i] = &myType{i * 7 % 30, 99}
+		q.Push(a[i])
+	}
+	lo, hi := 0, 29
+	for i := 0; q.Len() > 0; i++ {
+		if i%3 == 0 {
+			x, ok := q.PopMax()
+			if !ok || x.(*myType).value != hi {
+				t.Errorf("PopMax() = %v, %v; want %d, true", x, ok, hi)
+			}
+			hi--
+		} else {
+			if x := q.Pop().(*myType).value; x != lo {
+				t.Errorf("Pop() = %d; want %d", x, lo)
+			}
+			lo++
+		}
+		verify(t, q)
+	}
+}
+
+// A value type with a priority and a name.
+type job struct {
+	prio int
+	name string
+	tags []string // makes job not comparable with ==
+}
+
+func (x job) Less(y Interface) bool { return x.prio < y.(job).prio }
+func (x job) Index(i int)           {}
+
+func TestSetEqual(t *testing.T) {
+	var q Queue
+	for i, name := range []string{"a", "b", "c", "d", "e"} {
+		q.Push(job{5 - i, name, nil})
+	}
+	if i := q.IndexOf(myInt(3)); i != -1 {
+		t.Errorf("IndexOf() of absent element = %d; want -1", i)
+	}
+	q.SetEqual(func(a, b Interface) bool { return a.(job).name == b.(job).name })
+	if !q.Contains(job{0, "c", []string{"x"}}) {
+		t.Errorf("Contains(c) = false; want true")
+	}
+	if q.Contains(job{3, "z", nil}) {
+		t.Errorf("Contains(z) = true; want false")
+	}
+	i := q.IndexOf(job{name: "c"})
+	if x := q.Remove(i).(job); x.name != "c" {
+		t.Errorf("Remove(IndexOf(c)) = %v; want c", x)
+	}
+	verify(t, q)
+	if q.Contains(job{name: "c"}) || q.Len() != 4 {
+		t.Errorf("c still in queue after Remove")
+	}
+}
+
+func TestNextPriorities(t *testing.T) {
+	var q Queue
+	for i := 0; i < 20; i++ {
+		q.Push(myInt(i * 7 % 20))
+	}
+	key := func(x Interface) int64 { return int64(x.(myInt)) * 10 }
+	if k := q.NextPriorities(4, key); fmt.Sprint(k) != "[0 10 20 30]" {
+		t.Errorf("NextPriorities(4) = %v; want [0 10 20 30]", k)
+	}
+	if k := q.NextPriorities(100, key); len(k) != 20 {
+		t.Errorf("NextPriorities(100) returned %d keys; want 20", len(k))
+	}
+	if k := q.NextPriorities(0, key); k != nil {
+		t.Errorf("NextPriorities(0) = %v; want nil", k)
+	}
+	if q.Len() != 20 {
+		t.Errorf("Len() = %d after NextPriorities; want 20", q.Len())
+	}
+}
+
+func TestWriteSorted(t *testing.T) {
+	var q Queue
+	for i := 0; i < 10; i++ {
+		q.Push(myInt(i * 3 % 10))
+	}
+	var b strings.Builder
+	encode := func(w io.Writer, x Interface) error {
+		_, err := fmt.Fprintf(w, "%d,", x)
+		return err
+	}
+	if err := q.WriteSorted(&b, encode); err != nil {
+		t.Errorf("WriteSorted() = %v; want nil", err)
+	}
+	if s := b.String(); s != "0,1,2,3,4,5,6,7,8,9," {
+		t.Errorf("WriteSorted() wrote %q", s)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d after WriteSorted; want 0", q.Len())
+	}
+
+	for i := 0; i < 10; i++ {
+		q.Push(myInt(i))
+	}
+	errWrite := fmt.Errorf("write failed")
+	err := q.WriteSorted(&b, func(w io.Writer, x Interface) error {
+		if x == myInt(5) {
+			return errWrite
+		}
+		return nil
+	})
+	if err != errWrite || q.Len() != 4 {
+		t.Errorf("WriteSorted() = %v with %d left; want %v with 4 left", err, q.Len(), errWrite)
+	}
+}
+
+func TestReadInto(t *testing.T) {
+	encode := func(w io.Writer, x Interface) error {
+		_, err := fmt.Fprintln(w, x.(*myType).value)
+		return err
+	}
+	decode := func(r io.Reader) (Interface, bool, error) {
+		var v int
+		_, err := fmt.Fscanln(r, &v)
+		if err == io.EOF {
+			return nil, false, nil
+		}
+		return &myType{v, -1}, err == nil, err
+	}
+	for _, n := range []int{0, 3, 100} {
+		var src, dst Queue
+		for i := 0; i < 50; i++ {
+			src.Push(&myType{i * 7 % 50, -1})
+		}
+		for i := 0; i < n; i++ {
+			dst.Push(&myType{i * 3 % 100, -1})
+		}
+		var b bytes.Buffer
+		if err := src.WriteSorted(&b, encode); err != nil {
+			t.Fatal(err)
+		}
+		if err := ReadInto(&dst, &b, decode); err != nil {
+			t.Errorf("ReadInto() = %v; want nil", err)
+		}
+		verify(t, dst)
+		if dst.Len() != 50+n {
+			t.Errorf("Len() = %d; want %d", dst.Len(), 50+n)
+		}
+		for prev := -1; dst.Len() > 0; {
+			x := dst.Pop().(*myType).value
+			if x < prev {
+				t.Errorf("Pop() got %d after %d; want ascending", x, prev)
+			}
+			prev = x
+		}
+	}
+
+	var q Queue
+	if err := ReadInto(&q, strings.NewReader("3\n1\nx\n2\n"), decode); err == nil {
+		t.Errorf("ReadInto() of bad input = nil; want error")
+	}
+	if q.Len() != 2 || q.Peek().(*myType).value != 1 {
+		t.Errorf("elements decoded before the error were not kept")
+	}
+	verify(t, q)
+
+	w := Wrap(make([]Interface, 0, 4))
+	w.Push(&myType{5, -1})
+	if err := ReadInto(w, strings.NewReader("3\n1\n4\n2\n"), decode); err != ErrFull {
+		t.Errorf("ReadInto() past the capacity of a Wrap queue = %v; want ErrFull", err)
+	}
+	if w.Len() != 4 || w.Peek().(*myType).value != 1 {
+		t.Errorf("Len() = %d, Peek() = %v; want 4, 1", w.Len(), w.Peek())
+	}
+	verify(t, *w)
+}
+
+func TestHistory(t *testing.T) {
+	var p Queue
+	p.Push(myInt(1))
+	p.Pop()
+	if h := p.History(); h != nil {
+		t.Errorf("History() without the option = %v; want nil", h)
+	}
+
+	q := NewWithOptions(Options{History: 3})
+	for i := 9; i >= 0; i-- {
+		q.Push(myInt(i))
+	}
+	if h := q.History(); h != nil {
+		t.Errorf("History() before any Pop = %v; want nil", h)
+	}
+	q.Pop()
+	q.Pop()
+	if h := q.History(); fmt.Sprint(h) != "[0 1]" {
+		t.Errorf("History() = %v; want [0 1]", h)
+	}
+	q.Pop()
+	q.Pop()
+	q.Cycle(myInt(20))
+	q.GroupByPriority() // must not be recorded
+	if h := q.History(); fmt.Sprint(h) != "[2 3 4]" {
+		t.Errorf("History() = %v; want [2 3 4]", h)
+	}
+
+	// A deep clone starts with its own, empty history.
+	c := q.DeepClone(func(x Interface) Interface { return x })
+	if h := c.History(); h != nil {
+		t.Errorf("History() of deep clone = %v; want nil", h)
+	}
+	c.Pop()
+	c.Pop()
+	q.Pop()
+	if h := c.History(); fmt.Sprint(h) != "[5 6]" {
+		t.Errorf("History() of deep clone = %v; want [5 6]", h)
+	}
+	if h := q.History(); fmt.Sprint(h) != "[3 4 5]" {
+		t.Errorf("History() = %v; want [3 4 5]", h)
+	}
+}
+
+func TestSplitTopK(t *testing.T) {
+	for _, k := range []int{-1, 0, 1, 7, 20, 25} {
+		q := NewWithOptions(Options{Arity: 3})
+		in := make(map[*myType]bool)
+		for i := 0; i < 20; i++ {
+			x := &myType{(i * 7) % 20, 0}
+			in[x] = true
+			q.Push(x)
+		}
+		p := q.SplitTopK(k)
+		want := min(max(k, 0), 20)
+		if p.Len() != want || q.Len() != 20-want {
+			t.Errorf("SplitTopK(%d): Len() = %d, %d; want %d, %d", k, p.Len(), q.Len(), want, 20-want)
+		}
+		verify(t, p)
+		verify(t, q)
+		for i, x := range p.h {
+			if x.(*myType).index != i {
+				t.Errorf("SplitTopK(%d): index of %v = %d; want %d", k, x, x.(*myType).index, i)
+			}
+			if !in[x.(*myType)] {
+				t.Errorf("SplitTopK(%d): %v split twice or unknown", k, x)
+			}
+			delete(in, x.(*myType))
+		}
+		for i, x := range q.h {
+			if x.(*myType).index != i {
+				t.Errorf("SplitTopK(%d): index of %v = %d; want %d", k, x, x.(*myType).index, i)
+			}
+			if !in[x.(*myType)] {
+				t.Errorf("SplitTopK(%d): %v in both queues or unknown", k, x)
+			}
+			delete(in, x.(*myType))
+		}
+		for i := 0; p.Len() > 0; i++ {
+			if v := p.Pop().(*myType).value; v != i {
+				t.Errorf("SplitTopK(%d): %d.th pop = %d; want %d", k, i, v, i)
+			}
+		}
+		for i := want; q.Len() > 0; i++ {
+			if v := q.Pop().(*myType).value; v != i {
+				t.Errorf("SplitTopK(%d): pop = %d; want %d", k, v, i)
+			}
+		}
+	}
+}
+
+func TestSamePopOrder(t *testing.T) {
+	a := New(myInt(3), myInt(1), myInt(2))
+	b := NewWithOptions(Options{Arity: 4})
+	for i := 1; i <= 3; i++ {
+		b.Push(myInt(i))
+	}
+	if !SamePopOrder(&a, &b) {
+		t.Errorf("SamePopOrder(%v, %v) = false; want true", a.h, b.h)
+	}
+	if a.Len() != 3 || b.Len() != 3 {
+		t.Errorf("SamePopOrder changed the queues: Len() = %d, %d; want 3, 3", a.Len(), b.Len())
+	}
+
+	b.Push(myInt(0))
+	if SamePopOrder(&a, &b) {
+		t.Errorf("SamePopOrder with different lengths = true; want false")
+	}
+	a.Push(myInt(4))
+	if SamePopOrder(&a, &b) {
+		t.Errorf("SamePopOrder(%v, %v) = true; want false", a.h, b.h)
+	}
+
+	x := &myType{1, 0}
+	c := New(x)
+	d := New(&myType{1, 0})
+	if SamePopOrder(&c, &d) {
+		t.Errorf("SamePopOrder with distinct pointers = true; want false")
+	}
+	c.SetEqual(func(a, b Interface) bool { return a.(*myType).value == b.(*myType).value })
+	if !SamePopOrder(&c, &d) {
+		t.Errorf("SamePopOrder with SetEqual = false; want true")
+	}
+	if x.index != 0 {
+		t.Errorf("SamePopOrder changed index to %d; want 0", x.index)
+	}
+}
+
+func TestStatsReset(t *testing.T) {
+	q := NewWithOptions(Options{Stats: true})
+	for i := 0; i < 5; i++ {
+		q.Push(myInt(i))
+	}
+	q.Pop()
+	q.Remove(1)
+	want := Stats{Pushes: 5, Pops: 1, Removes: 1}
+	if s := q.StatsReset(); s != want {
+		t.Errorf("StatsReset() = %+v; want %+v", s, want)
+	}
+	q.Push(myInt(7))
+	q.Pop()
+	q.Fix(0)
+	want = Stats{Pushes: 1, Pops: 1, Fixes: 1}
+	if s := q.StatsReset(); s != want {
+		t.Errorf("StatsReset() = %+v; want %+v", s, want)
+	}
+	if s := q.Stats(); s != (Stats{}) {
+		t.Errorf("Stats() after StatsReset = %+v; want zero", s)
+	}
+}
+
+// A faulty element type whose Less is not transitive:
+// 0 sorts before 1, 1 before 2, and 2 before 0.
+type cyclicInt int
+
+func (x cyclicInt) Less(y Interface) bool { return (int(y.(cyclicInt))-int(x)+3)%3 == 1 }
+func (x cyclicInt) Index(i int)           {}
+
+func TestNewDebug(t *testing.T) {
+	a := make([]*myType, 10)
+	q := NewDebug()
+	for i := range a {
+		a[i] = &myType{i, 0}
+		q.Push(a[i])
+	}
+	q.Pop()
+	a[5].value = -1
+	q.Fix(a[5].index)
+	q.Remove(a[7].index)
+	q.Cycle(&myType{20, 0})
+	verify(t, q)
+
+	mustPanic := func(op string, f func()) {
+		t.Helper()
+		defer func() {
+			msg, _ := recover().(string)
+			if !strings.Contains(msg, "heap invariant violated") || !strings.HasSuffix(msg, "after "+op) {
+				t.Errorf("recover() = %q; want a heap violation after %s", msg, op)
+			}
+		}()
+		f()
+		t.Errorf("%s with a faulty Less did not panic", op)
+	}
+	p := NewDebug(cyclicInt(0), cyclicInt(1))
+	mustPanic("Push", func() { p.Push(cyclicInt(2)) })
+	r := NewWithOptions(Options{Arity: 3, Debug: true}, cyclicInt(0), cyclicInt(1))
+	mustPanic("MergeSorted", func() { r.MergeSorted([]Interface{cyclicInt(2)}) })
+}
+
+func TestCoalesce(t *testing.T) {
+	q := NewWithOptions(Options{Stable: true})
+	target := make(map[*myType]string)
+	var all []*myType
+	for i, tg := range []string{"a", "b", "a", "c", "a", "b"} {
+		x := &myType{10 - i, 0}
+		target[x] = tg
+		all = append(all, x)
+		q.Push(x)
+	}
+	Coalesce(&q, func(x Interface) string { return target[x.(*myType)] },
+		func(a, b Interface) Interface {
+			// Keep the more urgent event.
+			if b.Less(a) {
+				return b
+			}
+			return a
+		})
+	verify(t, q)
+	if q.Len() != 3 {
+		t.Fatalf("Len() = %d after Coalesce; want 3", q.Len())
+	}
+	for i, x := range q.h {
+		if x.(*myType).index != i {
+			t.Errorf("wrong index [%d] = %d", i, x.(*myType).index)
+		}
+	}
+	var got []string
+	for q.Len() > 0 {
+		x := q.Pop().(*myType)
+		got = append(got, fmt.Sprintf("%s%d", target[x], x.value))
+	}
+	if s := strings.Join(got, " "); s != "b5 a6 c7" {
+		t.Errorf("pops after Coalesce = %s; want b5 a6 c7", s)
+	}
+	for _, x := range all {
+		if x.index != -1 {
+			t.Errorf("index of %s%d = %d; want -1", target[x], x.value, x.index)
+		}
+	}
+}
+
+func TestSortedSlice(t *testing.T) {
+	var q Queue
+	if s := q.SortedSlice(); len(s) != 0 {
+		t.Errorf("SortedSlice() on empty queue = %v; want empty", s)
+	}
+	a := make([]*myType, 20)
+	for i := range a {
+		a[i] = &myType{i * 7 % 20, 0}
+		q.Push(a[i])
+	}
+	h := append([]Interface(nil), q.h...)
+	s := q.SortedSlice()
+	for i, x := range s {
+		if v := x.(*myType).value; v != i {
+			t.Errorf("SortedSlice()[%d] = %d; want %d", i, v, i)
+		}
+	}
+	for i, x := range q.h {
+		if x != h[i] || x.(*myType).index != i {
+			t.Errorf("SortedSlice changed the queue at [%d]", i)
+		}
+	}
+}
+
+func TestDrainBudget(t *testing.T) {
+	var q Queue
+	for i := 0; i < 100; i++ {
+		q.Push(&myType{i * 37 % 100, 0})
+	}
+	next := 0
+	process := func(x Interface) {
+		if v := x.(*myType).value; v != next {
+			t.Errorf("processed %d; want %d", v, next)
+		}
+		next++
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	n := q.DrainBudget(10*time.Millisecond, process)
+	elapsed := time.Since(start)
+	if n < 1 || n > 12 || n+q.Len() != 100 {
+		t.Errorf("DrainBudget(10ms) = %d with %d left; want about 10 of 100", n, q.Len())
+	}
+	if elapsed < 10*time.Millisecond {
+		t.Errorf("DrainBudget(10ms) returned after %v with elements left", elapsed)
+	}
+	verify(t, q)
+
+	if n := q.DrainBudget(-1, process); n != 0 {
+		t.Errorf("DrainBudget(-1) = %d; want 0", n)
+	}
+	q.DrainBudget(time.Hour, process)
+	if q.Len() != 0 || next != 100 {
+		t.Errorf("DrainBudget(1h) left %d elements after %d; want 0 after 100", q.Len(), next)
+	}
+}
+
+func TestCheckComparator(t *testing.T) {
+	samples := []Interface{myInt(3), myInt(1), myInt(4), myInt(1), myInt(5)}
+	if err := CheckComparator(samples, func(a, b Interface) bool { return a.Less(b) }); err != nil {
+		t.Errorf("CheckComparator(Less) = %v; want nil", err)
+	}
+	for _, tc := range []struct {
+		name string
+		less func(a, b Interface) bool
+		want string
+	}{
+		{"<=", func(a, b Interface) bool { return a.(myInt) <= b.(myInt) }, "irreflexive"},
+		{"!=", func(a, b Interface) bool { return a.(myInt) != b.(myInt) }, "asymmetric"},
+		{"next", func(a, b Interface) bool { return a.(myInt)+1 == b.(myInt) }, "transitive"},
+	} {
+		err := CheckComparator(samples, tc.less)
+		if err == nil || !strings.Contains(err.Error(), "not "+tc.want) {
+			t.Errorf("CheckComparator(%s) = %v; want a %s violation", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestSmallestK(t *testing.T) {
+	var calls int
+	q := NewWithOptions(Options{Arity: 3, Stable: true})
+	for i := 0; i < 1000; i++ {
+		q.Push(&myType{i * 389 % 100, 0}) // many ties
+	}
+	sorted := q.SortedSlice()
+	for _, k := range []int{-1, 0, 1, 5, 64, 1000, 2000} {
+		got := q.SmallestK(k)
+		if len(got) != min(max(k, 0), 1000) {
+			t.Errorf("len(SmallestK(%d)) = %d", k, len(got))
+			continue
+		}
+		for i, x := range got {
+			if x != sorted[i] {
+				t.Errorf("SmallestK(%d)[%d] = %v; want %v", k, i, x, sorted[i])
+				break
+			}
+		}
+	}
+	verify(t, q)
+
+	var r Queue
+	for i := 0; i < 1<<16; i++ {
+		r.Push(lessInt{i * 7919 % (1 << 16), &calls})
+	}
+	calls = 0
+	r.SmallestK(10)
+	if calls > 200 {
+		t.Errorf("SmallestK(10) of %d elements made %d comparisons; want O(k*log(k))", r.Len(), calls)
+	}
+}
+
+func TestPopWeight(t *testing.T) {
+	var q Queue
+	for _, v := range []int{5, 1, 4, 2, 3, 9} {
+		q.Push(&myType{v, 0})
+	}
+	weight := func(x Interface) int64 { return int64(x.(*myType).value) }
+	for _, tc := range []struct {
+		max  int64
+		want string
+	}{
+		{6, "1 2 3"}, // 4 would exceed the budget
+		{4, "4"},
+		{2, "5"}, // too heavy on its own, but returned
+		{100, "9"},
+		{100, ""},
+	} {
+		var got []string
+		for _, x := range q.PopWeight(tc.max, weight) {
+			got = append(got, fmt.Sprint(x.(*myType).value))
+		}
+		if s := strings.Join(got, " "); s != tc.want {
+			t.Errorf("PopWeight(%d) = [%s]; want [%s]", tc.max, s, tc.want)
+		}
+		verify(t, q)
+	}
+}
+
+func TestMergeSorted(t *testing.T) {
+	for _, opts := range []Options{{}, {Max: true}, {Stable: true, Arity: 4}} {
+		q := NewWithOptions(opts)
+		batch := func(lo, hi int) []Interface {
+			var s []Interface
+			for i := lo; i < hi; i++ {
+				s = append(s, &myType{i / 2, 0}) // pairs of ties
+			}
+			if opts.Max {
+				slices.Reverse(s)
+			}
+			return s
+		}
+		first := batch(10, 30)
+		q.MergeSorted(first)
+		verify(t, q)
+		q.MergeSorted(batch(0, 40))
+		verify(t, q)
+		q.MergeSorted(batch(5, 7))
+		verify(t, q)
+		if q.Len() != 62 {
+			t.Errorf("Len() = %d; want 62", q.Len())
+		}
+		for i, x := range q.h {
+			if x.(*myType).index != i {
+				t.Errorf("wrong index [%d] = %d", i, x.(*myType).index)
+			}
+		}
+		if opts.Stable {
+			// Equal elements come out in the order they were merged.
+			for i, x := range q.SortedSlice()[12:14] {
+				if x != first[i] {
+					t.Errorf("stable pop %d = %p; want %p", i, x, first[i])
+				}
+			}
+		}
+	}
+}
+
+func TestWouldRank(t *testing.T) {
+	for _, opts := range []Options{{}, {Max: true}, {Stable: true}, {Stable: true, Max: true, Arity: 3}} {
+		q := NewWithOptions(opts)
+		for i := 0; i < 200; i++ {
+			q.Push(&myType{i * 7919 % 50, 0})
+		}
+		for v := -1; v <= 50; v++ {
+			x := &myType{v, 0}
+			r := q.WouldRank(x)
+			c := q.clone()
+			c.Push(x)
+			want := slices.Index(c.SortedSlice(), Interface(x))
+			if !opts.Stable {
+				// Without Stable, x may come anywhere among its equals.
+				want = 0
+				for _, y := range c.SortedSlice() {
+					if y == Interface(x) || !y.Less(x) && !x.Less(y) {
+						break
+					}
+					want++
+				}
+			}
+			if r != want {
+				t.Errorf("%+v: WouldRank(%d) = %d; want %d", opts, v, r, want)
+			}
+		}
+		if q.Len() != 200 {
+			t.Errorf("WouldRank changed Len() to %d", q.Len())
+		}
+	}
+}
+
+func TestPeekAhead(t *testing.T) {
+	q := NewWithOptions(Options{Stable: true})
+	for i := 0; i < 30; i++ {
+		q.Push(&myType{i * 7 % 10, 0})
+	}
+	for _, m := range []int{-1, 30} {
+		if x, ok := q.PeekAhead(m); ok {
+			t.Errorf("PeekAhead(%d) = %v, true; want nil, false", m, x)
+		}
+	}
+	for m := 0; m < 30; m++ {
+		x, ok := q.PeekAhead(m)
+		c := q.clone()
+		for i := 0; i < m; i++ {
+			c.Pop()
+		}
+		if want := c.Pop(); !ok || x != want {
+			t.Errorf("PeekAhead(%d) = %v, %t; want %v, true", m, x, ok, want)
+		}
+	}
+	if x, _ := q.PeekAhead(0); x != q.Peek() {
+		t.Errorf("PeekAhead(0) = %v; want Peek() = %v", x, q.Peek())
+	}
+	verify(t, q)
+}
+
+func TestInterleave(t *testing.T) {
+	var a, b Queue
+	for i := 0; i < 20; i++ {
+		a.Push(myInt(i)) // a holds the smallest elements
+		b.Push(myInt(100 + i))
+	}
+	b.Push(myInt(-1))
+	var got []string
+	for x := range Interleave(&a, &b) {
+		got = append(got, fmt.Sprint(x))
+	}
+	if a.Len() != 0 || b.Len() != 0 {
+		t.Errorf("Interleave left %d and %d elements; want 0 and 0", a.Len(), b.Len())
+	}
+	// After InterleaveMaxRun = 4 elements from a, b gets a turn.
+	want := "-1 0 1 2 3 100 4 5 6 7 101 8 9 10 11 102 12 13 14 15 103 16 17 18 19 104"
+	for i := 105; i < 120; i++ {
+		want += fmt.Sprint(" ", i)
+	}
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("Interleave sent %s; want %s", s, want)
+	}
+}
+
+func TestMarshalPriorities(t *testing.T) {
+	var q Queue
+	keys := []int{5, -3, 1 << 40, 5, 0, -1 << 40, 7}
+	for _, k := range keys {
+		q.Push(&myType{k, 0})
+	}
+	key := func(x Interface) int64 { return int64(x.(*myType).value) }
+	data := q.MarshalPriorities(key)
+	if q.Len() != len(keys) {
+		t.Errorf("MarshalPriorities changed Len() to %d", q.Len())
+	}
+	r := LoadPriorities(data, func(k int64) Interface { return &myType{int(k), 0} })
+	verify(t, r)
+	for r.Len() > 0 || q.Len() > 0 {
+		if x, y := r.Pop().(*myType).value, q.Pop().(*myType).value; x != y {
+			t.Errorf("rebuilt queue popped %d; want %d", x, y)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		q.Push(&myType{1e9 + 3*i, 0})
+	}
+	if n := len(q.MarshalPriorities(key)); n > 1005 {
+		t.Errorf("len(MarshalPriorities()) = %d for 1000 close keys; want about 1000", n)
+	}
+
+	if p := LoadPriorities(nil, nil); p.Len() != 0 {
+		t.Errorf("LoadPriorities(nil).Len() = %d; want 0", p.Len())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("LoadPriorities with truncated data did not panic")
+		}
+	}()
+	LoadPriorities([]byte{0x80}, func(k int64) Interface { return myInt(k) })
+}
+
+func TestHasDuplicates(t *testing.T) {
+	var q Queue
+	id := func(x Interface) int { return x.(*myType).value }
+	if k, ok := HasDuplicates(&q, id); ok {
+		t.Errorf("HasDuplicates() on empty queue = %d, true; want 0, false", k)
+	}
+	for i := 1; i <= 10; i++ {
+		q.Push(&myType{i, 0})
+	}
+	if k, ok := HasDuplicates(&q, id); ok {
+		t.Errorf("HasDuplicates() = %d, true; want 0, false", k)
+	}
+	q.Push(&myType{7, 0})
+	if k, ok := HasDuplicates(&q, id); !ok || k != 7 {
+		t.Errorf("HasDuplicates() = %d, %t; want 7, true", k, ok)
+	}
+	x := q.h[3]
+	if _, ok := HasDuplicates(&q, func(y Interface) Interface { return y }); ok {
+		t.Errorf("HasDuplicates() by identity = true; want false")
+	}
+	q.Push(x)
+	if k, ok := HasDuplicates(&q, func(y Interface) Interface { return y }); !ok || k != x {
+		t.Errorf("HasDuplicates() by identity = %v, %t; want %v, true", k, ok, x)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	var empty Queue
+	if l := empty.Levels(); l != nil {
+		t.Errorf("Levels() on empty queue = %v; want nil", l)
+	}
+	for _, tc := range []struct {
+		d, n  int
+		sizes string
+	}{
+		{2, 1, "[1]"},
+		{2, 7, "[1 2 4]"},
+		{2, 12, "[1 2 4 5]"},
+		{3, 14, "[1 3 9 1]"},
+	} {
+		q := NewWithOptions(Options{Arity: tc.d})
+		for i := tc.n; i > 0; i-- {
+			q.Push(myInt(i))
+		}
+		levels := q.Levels()
+		var sizes []int
+		i := 0
+		for _, level := range levels {
+			sizes = append(sizes, len(level))
+			for _, x := range level {
+				if x != q.h[i] {
+					t.Errorf("d=%d n=%d: element %d = %v; want %v", tc.d, tc.n, i, x, q.h[i])
+				}
+				i++
+			}
+		}
+		if s := fmt.Sprint(sizes); s != tc.sizes {
+			t.Errorf("d=%d n=%d: level sizes = %s; want %s", tc.d, tc.n, s, tc.sizes)
+		}
+		levels[0][0] = nil
+		if q.h[0] == nil {
+			t.Errorf("Levels() shares memory with the queue")
+		}
+	}
+}
+
+func TestCountFunc(t *testing.T) {
+	for _, maxHeap := range []bool{false, true} {
+		q := NewWithOptions(Options{Max: maxHeap})
+		for i := 0; i < 100; i++ {
+			q.Push(&myType{i * 37 % 100, 0})
+		}
+		for _, th := range []int{-1, 0, 10, 55, 100} {
+			calls := 0
+			below := func(x Interface) bool {
+				calls++
+				if maxHeap {
+					return x.(*myType).value >= 100-th
+				}
+				return x.(*myType).value < th
+			}
+			if n := q.CountFunc(below, true); n != max(th, 0) {
+				t.Errorf("max=%t: CountFunc(< %d, true) = %d; want %d", maxHeap, th, n, max(th, 0))
+			}
+			if calls > 2*max(th, 1)+1 {
+				t.Errorf("max=%t: CountFunc(< %d, true) called pred %d times", maxHeap, th, calls)
+			}
+		}
+		odd := func(x Interface) bool { return x.(*myType).value%2 == 1 }
+		if n := q.CountFunc(odd, false); n != 50 {
+			t.Errorf("max=%t: CountFunc(odd, false) = %d; want 50", maxHeap, n)
+		}
+	}
+
+	var q Queue
+	a := make([]*myType, 15)
+	for i := range a {
+		a[i] = &myType{10 * i, 0}
+		q.Push(a[i])
+	}
+	q.Boost(a[14].index, &myType{-1, 0})
+	below := func(x Interface) bool { return x.(*myType).value < 35 }
+	if n := q.CountFunc(below, true); n != 4 {
+		t.Errorf("CountFunc(< 35, true) with boost = %d; want 4", n)
+	}
+}
+
+func TestNextPopCost(t *testing.T) {
+	for _, tc := range []struct{ d, n, want int }{
+		{2, 0, 0}, {2, 1, 0}, {2, 2, 0}, {2, 3, 1}, {2, 4, 1}, {2, 5, 2},
+		{2, 8, 2}, {2, 9, 3}, {2, 1024, 9}, {2, 1025, 10},
+		{4, 5, 1}, {4, 6, 1}, {4, 22, 2}, {4, 1 + 4 + 16 + 64 + 1, 3},
+	} {
+		q := NewWithOptions(Options{Arity: tc.d})
+		for i := 0; i < tc.n; i++ {
+			q.Push(myInt(i))
+		}
+		if c := q.NextPopCost(); c != tc.want {
+			t.Errorf("d=%d n=%d: NextPopCost() = %d; want %d", tc.d, tc.n, c, tc.want)
+		}
+	}
+}
+
+func TestFindEqual(t *testing.T) {
+	for _, maxHeap := range []bool{false, true} {
+		q := NewWithOptions(Options{Max: maxHeap})
+		for i := 0; i < 100; i++ {
+			q.Push(&myType{i * 37 % 20, 0})
+		}
+		for v := -1; v <= 20; v++ {
+			found := q.FindEqual(&myType{v, 0})
+			want := 5
+			if v < 0 || v >= 20 {
+				want = 0
+			}
+			if len(found) != want {
+				t.Errorf("max=%t: len(FindEqual(%d)) = %d; want %d", maxHeap, v, len(found), want)
+			}
+			seen := make(map[Interface]bool)
+			for _, x := range found {
+				if x.(*myType).value != v || seen[x] {
+					t.Errorf("max=%t: FindEqual(%d) returned %v", maxHeap, v, x)
+				}
+				seen[x] = true
+			}
+		}
+		verify(t, q)
+	}
+}
+
+func TestTopKFromFunc(t *testing.T) {
+	stream := func(n int) func() (Interface, bool) {
+		i := 0
+		return func() (Interface, bool) {
+			if i == n {
+				return nil, false
+			}
+			i++
+			return &myType{i * 7919 % n, 42}, true
+		}
+	}
+	for _, tc := range []struct{ k, n int }{{10, 1000}, {1, 50}, {20, 5}, {0, 10}, {3, 0}} {
+		top := TopKFromFunc(tc.k, stream(tc.n))
+		if want := min(max(tc.k, 0), tc.n); len(top) != want {
+			t.Errorf("len(TopKFromFunc(%d, %d elements)) = %d; want %d", tc.k, tc.n, len(top), want)
+			continue
+		}
+		for i, x := range top {
+			if x := x.(*myType); x.value != i || x.index != 42 {
+				t.Errorf("TopKFromFunc(%d, %d elements)[%d] = %v; want &{%d 42}", tc.k, tc.n, i, x, i)
+			}
+		}
+	}
+}
+
+// An element type that cannot be a map key.
+type vec []int
+
+func (x vec) Less(y Interface) bool { return x[0] < y.(vec)[0] }
+func (x vec) Index(i int)           {}
+
+func TestUnhashableElements(t *testing.T) {
+	build := func() Queue {
+		var q Queue
+		for i := 0; i < 10; i++ {
+			q.Push(vec{i * 3 % 10})
+		}
+		return q
+	}
+	q := build()
+	q.WouldChangeHead(vec{-1})
+	q.MinChangesOnPop()
+	q.WouldRank(vec{5})
+	q.FindEqual(vec{5})
+	c := q.DeepClone(func(x Interface) Interface { return append(vec(nil), x.(vec)...) })
+	verify(t, c)
+	p := q.SplitTopK(3)
+	verify(t, p)
+	q.PruneWorseThan(vec{8})
+	verify(t, q)
+
+	a, b := build(), build()
+	n := 0
+	for range Interleave(&a, &b) {
+		n++
+	}
+	if n != 20 {
+		t.Errorf("Interleave sent %d elements; want 20", n)
+	}
+}
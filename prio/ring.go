@@ -0,0 +1,75 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "errors"
+
+// ErrFull is returned by Push when a fixed-capacity queue is full.
+var ErrFull = errors.New("prio: queue is full")
+
+// RingQueue represents a priority queue with a fixed capacity.
+// The backing array is allocated once by NewRingQueue and never grows,
+// so no operation on a RingQueue allocates memory.
+type RingQueue struct {
+	q Queue
+}
+
+// NewRingQueue returns an empty priority queue that can hold up to capacity elements.
+func NewRingQueue(capacity int) RingQueue {
+	return RingQueue{Queue{h: make([]Interface, 0, capacity)}}
+}
+
+// Push pushes the element x onto the queue, or returns ErrFull if the queue is full.
+// The complexity is O(log(n)), where n = q.Len().
+func (r *RingQueue) Push(x Interface) error {
+	if len(r.q.h) == cap(r.q.h) {
+		return ErrFull
+	}
+	r.q.Push(x)
+	return nil
+}
+
+// Pop removes a minimum element (according to Less) from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len().
+func (r *RingQueue) Pop() Interface {
+	return r.q.Pop()
+}
+
+// Peek returns, but does not remove, a minimum element (according to Less) of the queue.
+func (r *RingQueue) Peek() Interface {
+	return r.q.Peek()
+}
+
+// Remove removes the element at index i from the queue and returns it.
+// The complexity is O(log(n)), where n = q.Len().
+func (r *RingQueue) Remove(i int) Interface {
+	return r.q.Remove(i)
+}
+
+// Fix reestablishes the heap ordering after the element at index i has changed its value.
+// The complexity is O(log(n)) where n = q.Len().
+func (r *RingQueue) Fix(i int) {
+	r.q.Fix(i)
+}
+
+// Len returns the number of elements in the queue.
+func (r *RingQueue) Len() int {
+	return len(r.q.h)
+}
+
+// Cap returns the maximum number of elements the queue can hold.
+func (r *RingQueue) Cap() int {
+	return cap(r.q.h)
+}
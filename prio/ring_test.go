@@ -0,0 +1,52 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "testing"
+
+func TestRingQueue(t *testing.T) {
+	r := NewRingQueue(8)
+	for i := 8; i > 0; i-- {
+		if err := r.Push(myInt(i)); err != nil {
+			t.Fatalf("Push(%d) = %v; want nil", i, err)
+		}
+	}
+	if err := r.Push(myInt(0)); err != ErrFull {
+		t.Errorf("Push on full queue = %v; want ErrFull", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if x := r.Pop().(myInt); int(x) != i {
+			t.Errorf("%d.th pop got %d; want %d", i, x, i)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := r.Push(myInt(i)); err != nil {
+			t.Errorf("Push(%d) after Pop = %v; want nil", i, err)
+		}
+	}
+	verify(t, r.q)
+	if r.Len() != 8 || r.Cap() != 8 {
+		t.Errorf("Len(), Cap() = %d, %d; want 8, 8", r.Len(), r.Cap())
+	}
+
+	x := Interface(myInt(42))
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Pop()
+		r.Push(x)
+	})
+	if allocs != 0 {
+		t.Errorf("Pop and Push allocated %v times; want 0", allocs)
+	}
+}
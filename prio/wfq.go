@@ -0,0 +1,104 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+// WFQueue represents a collection of priority queues, one per category,
+// that are served fairly according to per-category weights.
+// Within a category, elements are popped in priority order; across categories,
+// Pop uses deficit round robin, so that over time a category with weight w
+// gets w pops for every pop of a category with weight 1, and no nonempty
+// category starves.
+type WFQueue[K comparable] struct {
+	weights map[K]int
+	cats    map[K]*category
+	order   []K // round-robin order of the categories
+	pos     int // current position in order
+	n       int
+}
+
+type category struct {
+	q       Queue
+	weight  int
+	deficit int // number of pops left in the current round
+}
+
+// NewWFQueue returns an empty fair queue with the given category weights.
+// Categories not present in weights get weight 1.
+// It panics if a weight is not positive.
+func NewWFQueue[K comparable](weights map[K]int) *WFQueue[K] {
+	w := make(map[K]int, len(weights))
+	for k, v := range weights {
+		if v <= 0 {
+			panic("prio: weight must be positive")
+		}
+		w[k] = v
+	}
+	return &WFQueue[K]{weights: w, cats: make(map[K]*category)}
+}
+
+// Push pushes the element x onto the queue of the given category.
+// The complexity is O(log(n)), where n is the length of that queue.
+func (q *WFQueue[K]) Push(cat K, x Interface) {
+	c := q.cats[cat]
+	if c == nil {
+		w, ok := q.weights[cat]
+		if !ok {
+			w = 1
+		}
+		c = &category{weight: w}
+		q.cats[cat] = c
+		q.order = append(q.order, cat)
+	}
+	c.q.Push(x)
+	q.n++
+}
+
+// Pop removes the next element according to the fair schedule and returns it
+// with its category. It panics if the queue is empty.
+// The amortized complexity is O(c + log(n)), where c is the number of categories
+// and n is the length of the largest category queue.
+func (q *WFQueue[K]) Pop() (K, Interface) {
+	if q.n == 0 {
+		panic("prio: Pop from empty WFQueue")
+	}
+	for {
+		k := q.order[q.pos]
+		c := q.cats[k]
+		if c.q.Len() > 0 && c.deficit > 0 {
+			c.deficit--
+			q.n--
+			return k, c.q.Pop()
+		}
+		if c.q.Len() == 0 {
+			c.deficit = 0
+		}
+		q.pos = (q.pos + 1) % len(q.order)
+		next := q.cats[q.order[q.pos]]
+		next.deficit += next.weight
+	}
+}
+
+// Len returns the total number of elements in the queue.
+func (q *WFQueue[K]) Len() int {
+	return q.n
+}
+
+// LenCategory returns the number of elements of the given category.
+func (q *WFQueue[K]) LenCategory(cat K) int {
+	if c := q.cats[cat]; c != nil {
+		return c.q.Len()
+	}
+	return 0
+}
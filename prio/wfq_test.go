@@ -0,0 +1,67 @@
+// Copyright 2012 Stefan Nilsson
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio
+
+import "testing"
+
+func TestWFQueue(t *testing.T) {
+	q := NewWFQueue(map[string]int{"a": 1, "b": 2, "c": 3})
+	for i := 0; i < 600; i++ {
+		q.Push("a", myInt(i))
+		q.Push("b", myInt(600-i))
+		q.Push("c", myInt(i))
+		if i < 100 {
+			q.Push("d", myInt(i)) // weight 1 by default
+		}
+	}
+
+	count := make(map[string]int)
+	prev := make(map[string]myInt)
+	for i := 0; i < 700; i++ {
+		k, x := q.Pop()
+		if y, ok := prev[k]; ok && x.(myInt) < y {
+			t.Errorf("category %s popped %d after %d; want ascending", k, x, y)
+		}
+		prev[k] = x.(myInt)
+		count[k]++
+	}
+	want := map[string]int{"a": 100, "b": 200, "c": 300, "d": 100}
+	for k, n := range want {
+		if d := count[k] - n; d < -3 || d > 3 {
+			t.Errorf("category %s got %d pops; want about %d", k, count[k], n)
+		}
+	}
+
+	// Once d is empty, the others share the pops by weight.
+	for k := range count {
+		count[k] = 0
+	}
+	for i := 0; i < 600; i++ {
+		k, _ := q.Pop()
+		count[k]++
+	}
+	want = map[string]int{"a": 100, "b": 200, "c": 300}
+	for k, n := range want {
+		if d := count[k] - n; d < -3 || d > 3 {
+			t.Errorf("category %s got %d pops; want about %d", k, count[k], n)
+		}
+	}
+	if n := q.Len(); n != 1900-1300 {
+		t.Errorf("Len() = %d; want %d", n, 1900-1300)
+	}
+	if n := q.LenCategory("d"); n != 0 {
+		t.Errorf("LenCategory(d) = %d; want 0", n)
+	}
+}